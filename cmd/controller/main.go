@@ -4,25 +4,43 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/puppetlabs/fault-injector-controller/pkg/controller"
+	"github.com/puppetlabs/fault-injector-controller/pkg/server"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
 	"github.com/puppetlabs/fault-injector-controller/version"
 )
 
 var (
 	cfg          controller.Config
+	metricsAddr  string
 	printVersion bool
 	printImage   bool
 )
 
 func init() {
 	flagset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	hostname, _ := os.Hostname()
 
 	flagset.StringVar(&cfg.Host, "apiserver", "", "API Server addr, e.g. ' - NOT RECOMMENDED FOR PRODUCTION - http://127.0.0.1:8080'. Omit parameter to run in on-cluster mode and utilize the service account token.")
 	flagset.StringVar(&cfg.TLSConfig.CertFile, "cert-file", "", " - NOT RECOMMENDED FOR PRODUCTION - Path to public TLS certificate file.")
 	flagset.StringVar(&cfg.TLSConfig.KeyFile, "key-file", "", "- NOT RECOMMENDED FOR PRODUCTION - Path to private TLS certificate file.")
 	flagset.StringVar(&cfg.TLSConfig.CAFile, "ca-file", "", "- NOT RECOMMENDED FOR PRODUCTION - Path to TLS CA file.")
 	flagset.BoolVar(&cfg.TLSInsecure, "tls-insecure", false, "- NOT RECOMMENDED FOR PRODUCTION - Don't verify API server's CA certificate.")
+	flagset.BoolVar(&cfg.RequireOptIn, "require-opt-in", false, "Run every FaultInjector in opt-in mode, and refuse to create FaultInjectors in namespaces without the label or annotation "+spec.OptInMarker+"=true.")
+	flagset.IntVar(&cfg.Workers, "workers", 2, "Number of FaultInjectors to reconcile concurrently.")
+	flagset.DurationVar(&cfg.ResyncPeriod, "resync-period", 5*time.Minute, "How often every FaultInjector is reconciled, even if neither it nor its Deployment changed.")
+	flagset.BoolVar(&cfg.LeaderElect, "leader-elect", true, "Elect a leader among replicas of the controller, so that only the leader reconciles FaultInjectors.")
+	flagset.StringVar(&cfg.LeaderElectNamespace, "leader-elect-namespace", "", "Namespace of the leader election lock. Defaults to the namespace the controller runs in.")
+	flagset.StringVar(&cfg.LeaderElectIdentity, "leader-elect-identity", hostname, "Identity of this replica in the leader election. Defaults to the hostname, which is the pod name.")
+	flagset.DurationVar(&cfg.LeaseDuration, "leader-elect-lease-duration", 15*time.Second, "How long standby replicas wait after the leader last renewed its lease before taking over.")
+	flagset.DurationVar(&cfg.RenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "How long the leader keeps trying to renew its lease before it stops leading. Must be less than the lease duration.")
+	flagset.DurationVar(&cfg.RetryPeriod, "leader-elect-retry-period", 2*time.Second, "How long replicas wait between attempts to acquire or renew the lease.")
+	flagset.StringVar(&cfg.PolicyNamespace, "policy-namespace", "", "Namespace of the fault-injector-policy ConfigMap, which suspends every FaultInjector, and of the fault-injector-budget ConfigMap, which limits the faults injected by every injector. Defaults to the namespace the controller runs in.")
+	flagset.StringVar(&metricsAddr, "metrics-address", ":8080", "Address on which to serve Prometheus metrics at /metrics, and health checks at /healthz and /readyz. Set to an empty string to disable.")
 	flagset.BoolVar(&printVersion, "version", false, "Show version and quit")
 	flagset.BoolVar(&printImage, "image", false, "Show the image name for the application and quit")
 	flagset.Parse(os.Args[1:])
@@ -43,8 +61,30 @@ func main() {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
 	}
-	if err := c.Run(make(chan struct{})); err != nil {
+	if len(metricsAddr) > 0 {
+		go func() {
+			if err := server.ListenAndServe(metricsAddr, c.Ready); err != nil {
+				fmt.Fprintf(os.Stderr, "Error when serving on %v: %v\n", metricsAddr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if err := c.Run(stopOnSignal()); err != nil {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// stopOnSignal returns a channel which is closed when the process receives
+// SIGINT or SIGTERM.
+func stopOnSignal() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Printf("Received %v, shutting down\n", sig)
+		close(stop)
+	}()
+	return stop
+}
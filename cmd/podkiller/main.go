@@ -6,10 +6,16 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/puppetlabs/fault-injector-controller/pkg/budget"
 	"github.com/puppetlabs/fault-injector-controller/pkg/podkiller"
+	"github.com/puppetlabs/fault-injector-controller/pkg/schedule"
+	"github.com/puppetlabs/fault-injector-controller/pkg/server"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
 	"github.com/puppetlabs/fault-injector-controller/version"
 
 	"k8s.io/client-go/1.5/pkg/api"
@@ -17,6 +23,12 @@ import (
 
 var (
 	cfg          podkiller.Config
+	method       string
+	gracePeriod  int64
+	minAvailable string
+	interval     time.Duration
+	sched        spec.FaultInjectorSchedule
+	metricsAddr  string
 	printVersion bool
 	printImage   bool
 )
@@ -26,17 +38,62 @@ func init() {
 	var namespaceFile string
 	flagset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
+	flagset.StringVar(&cfg.Name, "name", "", "The name of the FaultInjector this PodKiller runs on behalf of, used when recording events.")
 	flagset.StringVar(&namespaceValue, "namespace", "", "The namespace to work in. Mutually exclusive with -namespace-file.")
 	flagset.StringVar(&namespaceFile, "namespace-file", "", "A file containing the namespace to work in. Mutually exclusive with -namespace.")
+	flagset.StringVar(&cfg.LabelSelector, "label-selector", "", "Only kill pods matching this label selector, e.g. 'app=checkout,tier=frontend'.")
+	flagset.StringVar(&cfg.FieldSelector, "field-selector", "", "Only kill pods matching this field selector, e.g. 'status.phase=Running'.")
+	flagset.DurationVar(&interval, "interval", time.Minute, "The base period between pod kills.")
+	flagset.DurationVar(&cfg.Jitter, "jitter", 0, "The maximum random delay added to each interval between pod kills.")
+	flagset.IntVar(&cfg.KillCount, "kill-count", 0, "The number of pods to kill each interval. Mutually exclusive with -kill-percent. Defaults to one pod.")
+	flagset.IntVar(&cfg.KillPercent, "kill-percent", 0, "The percentage of matching pods to kill each interval. Mutually exclusive with -kill-count.")
+	flagset.BoolVar(&cfg.OptIn, "opt-in", false, "Only kill pods which, or whose namespace, carry the label or annotation "+spec.OptInMarker+"=true.")
+	flagset.StringVar(&method, "method", string(spec.KillMethodDelete), "How to kill pods: 'delete', 'evict' to honor PodDisruptionBudgets, or 'forceDelete' to skip the termination grace period.")
+	flagset.Int64Var(&gracePeriod, "grace-period", -1, "Seconds given to each pod to terminate gracefully. Set to 0 to kill pods immediately. If negative, each pod's own termination grace period is used.")
+	flagset.StringVar(&minAvailable, "min-available", "", "Spare pods whose killing would leave their controller with fewer ready pods than this number, e.g. '2', or percentage, e.g. '50%'.")
+	flagset.BoolVar(&cfg.DryRun, "dry-run", false, "Log and record an event for each pod which would have been killed, without killing it.")
+	flagset.StringVar(&sched.TimeZone, "schedule-time-zone", "", "The IANA time zone in which the schedule is evaluated, e.g. 'Europe/London'. Defaults to UTC.")
+	flagset.StringVar(&sched.Cron, "schedule-cron", "", "Only kill pods during minutes matching this cron expression, e.g. '* 10-15 * * Mon-Fri'.")
+	flagset.Var((*windowsValue)(&sched.Windows), "schedule-window", "Only kill pods during this weekly window, e.g. 'Mon-Fri 10:00-16:00'. May be given several times.")
+	flagset.StringVar(&cfg.BudgetNamespace, "budget-namespace", "", "The namespace of the "+budget.ConfigMap+" ConfigMap limiting the faults injected by every injector. If empty, no budget is enforced.")
 	flagset.StringVar(&cfg.Host, "apiserver", "", "API Server addr, e.g. ' - NOT RECOMMENDED FOR PRODUCTION - http://127.0.0.1:8080'. Omit parameter to run in on-cluster mode and utilize the service account token.")
 	flagset.StringVar(&cfg.TLSConfig.CertFile, "cert-file", "", " - NOT RECOMMENDED FOR PRODUCTION - Path to public TLS certificate file.")
 	flagset.StringVar(&cfg.TLSConfig.KeyFile, "key-file", "", "- NOT RECOMMENDED FOR PRODUCTION - Path to private TLS certificate file.")
 	flagset.StringVar(&cfg.TLSConfig.CAFile, "ca-file", "", "- NOT RECOMMENDED FOR PRODUCTION - Path to TLS CA file.")
 	flagset.BoolVar(&cfg.TLSInsecure, "tls-insecure", false, "- NOT RECOMMENDED FOR PRODUCTION - Don't verify API server's CA certificate.")
+	flagset.StringVar(&metricsAddr, "metrics-address", ":8080", "Address on which to serve Prometheus metrics at /metrics, and health checks at /healthz and /readyz. Set to an empty string to disable.")
 	flagset.BoolVar(&printVersion, "version", false, "Show version and quit")
 	flagset.BoolVar(&printImage, "image", false, "Show the image name for the application and quit")
 	flagset.Parse(os.Args[1:])
 
+	if interval <= 0 {
+		fmt.Fprint(os.Stderr, "-interval must be a positive duration!")
+		os.Exit(1)
+	}
+	if cfg.Jitter < 0 {
+		fmt.Fprint(os.Stderr, "-jitter must not be a negative duration!")
+		os.Exit(1)
+	}
+
+	cfg.Method = spec.KillMethod(method)
+	if sched.Cron != "" || len(sched.Windows) > 0 {
+		cfg.Schedule = &sched
+	} else if sched.TimeZone != "" {
+		fmt.Fprint(os.Stderr, "-schedule-time-zone requires -schedule-cron or -schedule-window!")
+		os.Exit(1)
+	}
+	if gracePeriod >= 0 {
+		cfg.GracePeriodSeconds = &gracePeriod
+	}
+	if minAvailable != "" {
+		value, err := spec.ParseMinAvailable(minAvailable)
+		if err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.MinAvailable = &value
+	}
+
 	if namespaceValue != "" && namespaceFile != "" {
 		fmt.Fprint(os.Stderr, "Cannot specify both -namespace and -namespace-file!")
 		os.Exit(1)
@@ -59,6 +116,26 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+// windowsValue is a flag.Value collecting schedule windows.
+type windowsValue []spec.ScheduleWindow
+
+func (v *windowsValue) String() string {
+	var windows []string
+	for _, w := range *v {
+		windows = append(windows, schedule.FormatWindow(w))
+	}
+	return strings.Join(windows, ", ")
+}
+
+func (v *windowsValue) Set(value string) error {
+	w, err := schedule.ParseWindow(value)
+	if err != nil {
+		return err
+	}
+	*v = append(*v, w)
+	return nil
+}
+
 func main() {
 	if printVersion {
 		fmt.Println(version.Version)
@@ -74,8 +151,30 @@ func main() {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
 	}
-	if err := p.Run(time.Minute, make(chan struct{})); err != nil {
+	if len(metricsAddr) > 0 {
+		go func() {
+			if err := server.ListenAndServe(metricsAddr, p.Ready); err != nil {
+				fmt.Fprintf(os.Stderr, "Error when serving on %v: %v\n", metricsAddr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if err := p.Run(interval, stopOnSignal()); err != nil {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// stopOnSignal returns a channel which is closed when the process receives
+// SIGINT or SIGTERM.
+func stopOnSignal() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Printf("Received %v, shutting down\n", sig)
+		close(stop)
+	}()
+	return stop
+}
@@ -0,0 +1,74 @@
+package apiextensions
+
+import (
+	"encoding/json"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/runtime/serializer"
+	"k8s.io/client-go/1.5/rest"
+)
+
+// Resource is the plural resource name of CustomResourceDefinitions.
+const Resource = "customresourcedefinitions"
+
+// Interface can read and create CustomResourceDefinitions.
+type Interface interface {
+	Get(name string) (*CustomResourceDefinition, error)
+	Create(crd *CustomResourceDefinition) (*CustomResourceDefinition, error)
+}
+
+type customResourceDefinitions struct {
+	client *rest.RESTClient
+}
+
+// New creates a new CustomResourceDefinition client from a Kubernetes client
+// config.
+func New(cfg rest.Config) (Interface, error) {
+	cfg.APIPath = "/apis"
+	cfg.GroupVersion = &unversioned.GroupVersion{
+		Group:   GroupName,
+		Version: Version,
+	}
+	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
+
+	client, err := rest.RESTClientFor(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &customResourceDefinitions{client: client}, nil
+}
+
+// Get retrieves a single CustomResourceDefinition.
+func (c *customResourceDefinitions) Get(name string) (*CustomResourceDefinition, error) {
+	b, err := c.client.Get().
+		Resource(Resource).
+		Name(name).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result CustomResourceDefinition
+	return &result, json.Unmarshal(b, &result)
+}
+
+// Create creates a new CustomResourceDefinition.
+func (c *customResourceDefinitions) Create(crd *CustomResourceDefinition) (*CustomResourceDefinition, error) {
+	crd.TypeMeta = unversioned.TypeMeta{
+		Kind:       "CustomResourceDefinition",
+		APIVersion: GroupName + "/" + Version,
+	}
+	body, err := json.Marshal(crd)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.client.Post().
+		Resource(Resource).
+		Body(body).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result CustomResourceDefinition
+	return &result, json.Unmarshal(b, &result)
+}
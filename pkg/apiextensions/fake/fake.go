@@ -0,0 +1,58 @@
+// Package fake implements an in-memory CustomResourceDefinition client for
+// testing.
+package fake
+
+import (
+	"sync"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/apiextensions"
+
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+var resource = unversioned.GroupResource{Group: apiextensions.GroupName, Resource: apiextensions.Resource}
+
+// Client is an in-memory implementation of apiextensions.Interface. Created
+// CustomResourceDefinitions are immediately established.
+type Client struct {
+	lock    sync.Mutex
+	objects map[string]*apiextensions.CustomResourceDefinition
+}
+
+var _ apiextensions.Interface = &Client{}
+
+// New creates an empty fake client.
+func New() *Client {
+	return &Client{objects: make(map[string]*apiextensions.CustomResourceDefinition)}
+}
+
+// Get retrieves a copy of a single CustomResourceDefinition.
+func (c *Client) Get(name string) (*apiextensions.CustomResourceDefinition, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	crd, ok := c.objects[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource, name)
+	}
+	result := *crd
+	return &result, nil
+}
+
+// Create stores an established copy of a CustomResourceDefinition.
+func (c *Client) Create(crd *apiextensions.CustomResourceDefinition) (*apiextensions.CustomResourceDefinition, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.objects[crd.ObjectMeta.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(resource, crd.ObjectMeta.Name)
+	}
+	created := *crd
+	created.Status.Conditions = []apiextensions.CustomResourceDefinitionCondition{
+		{Type: apiextensions.NamesAccepted, Status: v1.ConditionTrue},
+		{Type: apiextensions.Established, Status: v1.ConditionTrue},
+	}
+	c.objects[crd.ObjectMeta.Name] = &created
+	result := created
+	return &result, nil
+}
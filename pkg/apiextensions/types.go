@@ -0,0 +1,135 @@
+// Package apiextensions implements the subset of the
+// apiextensions.k8s.io/v1beta1 API needed to register
+// CustomResourceDefinitions, which is not available in the Kubernetes client
+// library used by the FaultInjector. The v1beta1 API is served alongside the
+// extensions/v1beta1 Deployments which the controller manages.
+package apiextensions
+
+import (
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// GroupName is the API group of CustomResourceDefinitions.
+const GroupName = "apiextensions.k8s.io"
+
+// Version is the API version of CustomResourceDefinitions.
+const Version = "v1beta1"
+
+// CustomResourceDefinition registers a custom resource with the API server.
+type CustomResourceDefinition struct {
+	unversioned.TypeMeta `json:",inline"`
+	v1.ObjectMeta        `json:"metadata,omitempty"`
+	Spec                 CustomResourceDefinitionSpec   `json:"spec"`
+	Status               CustomResourceDefinitionStatus `json:"status,omitempty"`
+}
+
+// CustomResourceDefinitionSpec describes how a custom resource is served.
+// The validation, subresources and printer columns are ignored by API
+// servers which do not support them yet.
+type CustomResourceDefinitionSpec struct {
+	Group                    string                           `json:"group"`
+	Version                  string                           `json:"version"`
+	Names                    CustomResourceDefinitionNames    `json:"names"`
+	Scope                    ResourceScope                    `json:"scope"`
+	Validation               *CustomResourceValidation        `json:"validation,omitempty"`
+	Subresources             *CustomResourceSubresources      `json:"subresources,omitempty"`
+	AdditionalPrinterColumns []CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
+}
+
+// CustomResourceDefinitionNames holds the names under which a custom
+// resource is served.
+type CustomResourceDefinitionNames struct {
+	Plural     string   `json:"plural"`
+	Singular   string   `json:"singular,omitempty"`
+	ShortNames []string `json:"shortNames,omitempty"`
+	Kind       string   `json:"kind"`
+	ListKind   string   `json:"listKind,omitempty"`
+}
+
+// ResourceScope is whether a custom resource is namespaced.
+type ResourceScope string
+
+const (
+	// NamespaceScoped resources live in a namespace.
+	NamespaceScoped ResourceScope = "Namespaced"
+	// ClusterScoped resources do not live in a namespace.
+	ClusterScoped ResourceScope = "Cluster"
+)
+
+// CustomResourceValidation holds the schema of a custom resource.
+type CustomResourceValidation struct {
+	OpenAPIV3Schema *JSONSchemaProps `json:"openAPIV3Schema,omitempty"`
+}
+
+// CustomResourceSubresources enables subresources of a custom resource.
+type CustomResourceSubresources struct {
+	Status *CustomResourceSubresourceStatus `json:"status,omitempty"`
+}
+
+// CustomResourceSubresourceStatus enables the status subresource, which
+// makes the API server ignore status in updates of the main resource.
+type CustomResourceSubresourceStatus struct{}
+
+// CustomResourceColumnDefinition is a column shown by kubectl get.
+type CustomResourceColumnDefinition struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	JSONPath    string `json:"JSONPath"`
+	Priority    int32  `json:"priority,omitempty"`
+}
+
+// JSONSchemaProps is an OpenAPI v3 schema. Only the keywords used by the
+// FaultInjector are supported.
+type JSONSchemaProps struct {
+	Type        string                     `json:"type,omitempty"`
+	Format      string                     `json:"format,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Enum        []interface{}              `json:"enum,omitempty"`
+	Minimum     *float64                   `json:"minimum,omitempty"`
+	Maximum     *float64                   `json:"maximum,omitempty"`
+	Properties  map[string]JSONSchemaProps `json:"properties,omitempty"`
+	Items       *JSONSchemaProps           `json:"items,omitempty"`
+	Required    []string                   `json:"required,omitempty"`
+	// XIntOrString allows either an integer or a string, in place of a type.
+	XIntOrString bool `json:"x-kubernetes-int-or-string,omitempty"`
+}
+
+// CustomResourceDefinitionStatus reports the state of a
+// CustomResourceDefinition.
+type CustomResourceDefinitionStatus struct {
+	Conditions []CustomResourceDefinitionCondition `json:"conditions,omitempty"`
+}
+
+// CustomResourceDefinitionConditionType is the type of a
+// CustomResourceDefinitionCondition.
+type CustomResourceDefinitionConditionType string
+
+const (
+	// Established means the API server is serving the custom resource.
+	Established CustomResourceDefinitionConditionType = "Established"
+	// NamesAccepted means the names of the custom resource do not conflict
+	// with those of another resource.
+	NamesAccepted CustomResourceDefinitionConditionType = "NamesAccepted"
+)
+
+// CustomResourceDefinitionCondition describes one aspect of the state of a
+// CustomResourceDefinition.
+type CustomResourceDefinitionCondition struct {
+	Type    CustomResourceDefinitionConditionType `json:"type"`
+	Status  v1.ConditionStatus                    `json:"status"`
+	Reason  string                                `json:"reason,omitempty"`
+	Message string                                `json:"message,omitempty"`
+}
+
+// IsEstablished returns whether the API server is serving the custom
+// resource registered by a CustomResourceDefinition.
+func (crd *CustomResourceDefinition) IsEstablished() bool {
+	for _, condition := range crd.Status.Conditions {
+		if condition.Type == Established {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+// Package budget limits the faults injected by every injector in a cluster.
+// The limits and a ledger of recent faults are kept in a shared ConfigMap,
+// and each injector records a fault in the ledger before injecting it, so
+// that injectors acting independently stay within the limits together.
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/pods"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// ConfigMap is the name of the ConfigMap holding the budget.
+const ConfigMap = "fault-injector-budget"
+
+// Keys of the budget ConfigMap. Every limit is optional, and unlimited if
+// unset or zero.
+const (
+	// WindowKey is the period over which faults are counted. Defaults to
+	// DefaultWindow.
+	WindowKey = "window"
+	// MaxFaultsKey limits the faults injected in the cluster per window.
+	MaxFaultsKey = "maxFaults"
+	// MaxFaultsPerNamespaceKey limits the faults injected in each namespace
+	// per window.
+	MaxFaultsPerNamespaceKey = "maxFaultsPerNamespace"
+	// MaxFaultsPerOwnerKey limits the faults injected on the pods of each
+	// controller per window.
+	MaxFaultsPerOwnerKey = "maxFaultsPerOwner"
+	// MaxUnavailablePerOwnerKey limits the pods of each controller which may
+	// be unavailable at once. A pod is unavailable while it is not ready or
+	// terminating.
+	MaxUnavailablePerOwnerKey = "maxUnavailablePerOwner"
+	// LedgerKey holds the faults injected during the current window as a
+	// JSON list. It is written by the injectors.
+	LedgerKey = "ledger"
+)
+
+// DefaultWindow is the period over which faults are counted if the budget
+// does not set one.
+const DefaultWindow = time.Minute
+
+// acquireRetries is the number of times a fault is recorded in the ledger
+// when the update conflicts with another injector.
+const acquireRetries = 5
+
+// Limits are the limits set by the budget ConfigMap.
+type Limits struct {
+	Window                 time.Duration
+	MaxFaults              int
+	MaxFaultsPerNamespace  int
+	MaxFaultsPerOwner      int
+	MaxUnavailablePerOwner int
+}
+
+// Fault is a fault recorded in the ledger.
+type Fault struct {
+	Time          unversioned.Time `json:"time"`
+	Namespace     string           `json:"namespace"`
+	Pod           string           `json:"pod,omitempty"`
+	Owner         string           `json:"owner,omitempty"`
+	FaultInjector string           `json:"faultInjector,omitempty"`
+}
+
+// is returns whether two faults are the same, once recorded in the ledger.
+func (f Fault) is(other Fault) bool {
+	return f.Time.Unix() == other.Time.Unix() && f.Namespace == other.Namespace && f.Pod == other.Pod &&
+		f.Owner == other.Owner && f.FaultInjector == other.FaultInjector
+}
+
+// DeniedError is returned when a fault would exceed the budget. Its Window is
+// zero for limits which are not counted over a window.
+type DeniedError struct {
+	Limit  string
+	Max    int
+	Window time.Duration
+}
+
+func (e *DeniedError) Error() string {
+	if e.Window == 0 {
+		return fmt.Sprintf("Denied by ConfigMap %v: %v allows %v unavailable pods", ConfigMap, e.Limit, e.Max)
+	}
+	return fmt.Sprintf("Denied by ConfigMap %v: %v allows %v faults per %v", ConfigMap, e.Limit, e.Max, e.Window)
+}
+
+// IsDenied returns whether an error was returned because a fault would
+// exceed the budget.
+func IsDenied(err error) bool {
+	_, ok := err.(*DeniedError)
+	return ok
+}
+
+// Budget records faults in the budget ConfigMap of a namespace.
+type Budget struct {
+	kclient   kubernetes.Interface
+	namespace string
+	now       func() time.Time
+}
+
+// New creates a Budget kept in the given namespace.
+func New(kclient kubernetes.Interface, namespace string) *Budget {
+	return &Budget{kclient: kclient, namespace: namespace, now: time.Now}
+}
+
+// Acquire records a fault in the ledger if the budget allows it, and returns
+// a *DeniedError if it does not. Every fault is allowed if the budget
+// ConfigMap does not exist. The recorded fault is returned, so that it can be
+// released if it is not injected after all.
+func (b *Budget) Acquire(fault Fault) (Fault, error) {
+	for i := 0; i < acquireRetries; i++ {
+		cm, err := b.kclient.Core().ConfigMaps(b.namespace).Get(ConfigMap)
+		if apierrors.IsNotFound(err) {
+			return fault, nil
+		} else if err != nil {
+			return fault, err
+		}
+		limits, err := ParseLimits(cm.Data)
+		if err != nil {
+			return fault, err
+		}
+		if err := b.checkUnavailable(limits, fault); err != nil {
+			return fault, err
+		}
+		if limits.MaxFaults == 0 && limits.MaxFaultsPerNamespace == 0 && limits.MaxFaultsPerOwner == 0 {
+			return fault, nil
+		}
+		now := b.now()
+		fault.Time = unversioned.NewTime(now)
+		ledger, err := limits.admit(parseLedger(cm.Data[LedgerKey]), fault)
+		if err != nil {
+			return fault, err
+		}
+		err = b.updateLedger(cm, ledger)
+		if !apierrors.IsConflict(err) {
+			return fault, err
+		}
+	}
+	return fault, fmt.Errorf("Error when recording fault in ConfigMap %v: gave up after %v conflicts", ConfigMap, acquireRetries)
+}
+
+// Release removes a fault returned by Acquire from the ledger, so that a
+// fault which could not be injected does not count against the budget.
+func (b *Budget) Release(fault Fault) error {
+	if fault.Time.IsZero() {
+		return nil
+	}
+	for i := 0; i < acquireRetries; i++ {
+		cm, err := b.kclient.Core().ConfigMaps(b.namespace).Get(ConfigMap)
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ledger := parseLedger(cm.Data[LedgerKey])
+		released := false
+		for j, f := range ledger {
+			if f.is(fault) {
+				ledger = append(ledger[:j], ledger[j+1:]...)
+				released = true
+				break
+			}
+		}
+		if !released {
+			return nil
+		}
+		err = b.updateLedger(cm, ledger)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("Error when releasing fault in ConfigMap %v: gave up after %v conflicts", ConfigMap, acquireRetries)
+}
+
+// updateLedger replaces the ledger of the budget ConfigMap. The update fails
+// with a conflict if cm is not the latest version of the ConfigMap.
+func (b *Budget) updateLedger(cm *v1.ConfigMap, ledger []Fault) error {
+	value, err := json.Marshal(ledger)
+	if err != nil {
+		return err
+	}
+	data := make(map[string]string)
+	for k, v := range cm.Data {
+		data[k] = v
+	}
+	data[LedgerKey] = string(value)
+	cm.Data = data
+	_, err = b.kclient.Core().ConfigMaps(b.namespace).Update(cm)
+	return err
+}
+
+// checkUnavailable returns a *DeniedError if the controller owning the victim
+// of a fault already has as many unavailable pods as the budget allows. The
+// victim itself is not counted, as killing it leaves it unavailable anyway.
+func (b *Budget) checkUnavailable(limits Limits, fault Fault) error {
+	if limits.MaxUnavailablePerOwner == 0 || fault.Owner == "" {
+		return nil
+	}
+	list, err := b.kclient.Core().Pods(fault.Namespace).List(api.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("Error when counting the unavailable pods of %v: %v", fault.Owner, err)
+	}
+	unavailable := 0
+	for _, pod := range list.Items {
+		if pod.ObjectMeta.Name != fault.Pod && OwnerOf(pod) == fault.Owner && !pods.IsAvailable(pod) {
+			unavailable++
+		}
+	}
+	if unavailable >= limits.MaxUnavailablePerOwner {
+		return &DeniedError{Limit: MaxUnavailablePerOwnerKey, Max: limits.MaxUnavailablePerOwner}
+	}
+	return nil
+}
+
+// admit returns the ledger with a fault appended and the faults which fell
+// out of the window removed, or a *DeniedError if the fault would exceed a
+// limit.
+func (l Limits) admit(ledger []Fault, fault Fault) ([]Fault, error) {
+	start := fault.Time.Add(-l.Window)
+	var current []Fault
+	total, namespace, owner := 0, 0, 0
+	for _, f := range ledger {
+		if !f.Time.After(start) {
+			continue
+		}
+		current = append(current, f)
+		total++
+		if f.Namespace == fault.Namespace {
+			namespace++
+			if fault.Owner != "" && f.Owner == fault.Owner {
+				owner++
+			}
+		}
+	}
+	switch {
+	case l.MaxFaults > 0 && total >= l.MaxFaults:
+		return nil, &DeniedError{MaxFaultsKey, l.MaxFaults, l.Window}
+	case l.MaxFaultsPerNamespace > 0 && namespace >= l.MaxFaultsPerNamespace:
+		return nil, &DeniedError{MaxFaultsPerNamespaceKey, l.MaxFaultsPerNamespace, l.Window}
+	case l.MaxFaultsPerOwner > 0 && fault.Owner != "" && owner >= l.MaxFaultsPerOwner:
+		return nil, &DeniedError{MaxFaultsPerOwnerKey, l.MaxFaultsPerOwner, l.Window}
+	}
+	return append(current, fault), nil
+}
+
+// ParseLimits parses the limits set in the data of the budget ConfigMap.
+func ParseLimits(data map[string]string) (Limits, error) {
+	limits := Limits{Window: DefaultWindow}
+	if value, ok := data[WindowKey]; ok {
+		window, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || window <= 0 {
+			return limits, fmt.Errorf("Invalid value %q for %v in ConfigMap %v: must be a positive duration", value, WindowKey, ConfigMap)
+		}
+		limits.Window = window
+	}
+	for key, limit := range map[string]*int{
+		MaxFaultsKey:              &limits.MaxFaults,
+		MaxFaultsPerNamespaceKey:  &limits.MaxFaultsPerNamespace,
+		MaxFaultsPerOwnerKey:      &limits.MaxFaultsPerOwner,
+		MaxUnavailablePerOwnerKey: &limits.MaxUnavailablePerOwner,
+	} {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("Invalid value %q for %v in ConfigMap %v: must be a non-negative integer", value, key, ConfigMap)
+		}
+		*limit = n
+	}
+	return limits, nil
+}
+
+// parseLedger parses the ledger of the budget ConfigMap. A ledger which
+// cannot be parsed is discarded, and starts again empty.
+func parseLedger(value string) []Fault {
+	var ledger []Fault
+	if value == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), &ledger); err != nil {
+		return nil
+	}
+	return ledger
+}
+
+// OwnerOf returns the kind and name of the controller owning a pod, or an
+// empty string for a pod with no controller.
+func OwnerOf(pod v1.Pod) string {
+	if owner := pods.ControllerOf(pod.ObjectMeta); owner != nil {
+		return owner.Kind + "/" + owner.Name
+	}
+	return ""
+}
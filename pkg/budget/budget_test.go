@@ -0,0 +1,195 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := map[string]struct {
+		data     map[string]string
+		expected Limits
+		valid    bool
+	}{
+		"Empty":           {nil, Limits{Window: DefaultWindow}, true},
+		"All":             {map[string]string{WindowKey: "10m", MaxFaultsKey: "10", MaxFaultsPerNamespaceKey: " 5 ", MaxFaultsPerOwnerKey: "1", MaxUnavailablePerOwnerKey: "2"}, Limits{10 * time.Minute, 10, 5, 1, 2}, true},
+		"InvalidWindow":   {map[string]string{WindowKey: "soon"}, Limits{}, false},
+		"NegativeWindow":  {map[string]string{WindowKey: "-1m"}, Limits{}, false},
+		"InvalidLimit":    {map[string]string{MaxFaultsKey: "ten"}, Limits{}, false},
+		"NegativeLimit":   {map[string]string{MaxFaultsPerOwnerKey: "-1"}, Limits{}, false},
+		"LedgerIgnored":   {map[string]string{LedgerKey: "[]"}, Limits{Window: DefaultWindow}, true},
+		"ZeroIsUnlimited": {map[string]string{MaxFaultsKey: "0"}, Limits{Window: DefaultWindow}, true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			limits, err := ParseLimits(test.data)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("Expected an error, but found limits %+v", limits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Found unexpected error: %v", err)
+			}
+			if limits != test.expected {
+				t.Errorf("Expected limits %+v, but found %+v", test.expected, limits)
+			}
+		})
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	now := time.Date(2018, 1, 8, 14, 0, 0, 0, time.UTC)
+	clientset := fkubernetes.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: ConfigMap, Namespace: "chaos"},
+		Data: map[string]string{
+			WindowKey:                "1m",
+			MaxFaultsKey:             "3",
+			MaxFaultsPerNamespaceKey: "2",
+			MaxFaultsPerOwnerKey:     "1",
+		},
+	})
+	b := New(clientset, "chaos")
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		fault Fault
+		limit string
+	}{
+		{Fault{Namespace: "lanthanides", Owner: "ReplicaSet/cerium"}, ""},
+		{Fault{Namespace: "lanthanides", Owner: "ReplicaSet/cerium"}, MaxFaultsPerOwnerKey},
+		{Fault{Namespace: "lanthanides", Owner: "ReplicaSet/erbium"}, ""},
+		{Fault{Namespace: "lanthanides"}, MaxFaultsPerNamespaceKey},
+		{Fault{Namespace: "actinides"}, ""},
+		{Fault{Namespace: "noble-gases"}, MaxFaultsKey},
+	}
+	for i, step := range steps {
+		_, err := b.Acquire(step.fault)
+		switch {
+		case step.limit == "" && err != nil:
+			t.Errorf("Expected fault %v to be allowed, but found %v", i, err)
+		case step.limit != "" && (!IsDenied(err) || err.(*DeniedError).Limit != step.limit):
+			t.Errorf("Expected fault %v to be denied by %v, but found %v", i, step.limit, err)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := b.Acquire(Fault{Namespace: "noble-gases"}); err != nil {
+		t.Errorf("Expected faults to be allowed once the window passed, but found %v", err)
+	}
+	cm, err := clientset.Core().ConfigMaps("chaos").Get(ConfigMap)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting ConfigMap: %v", err)
+	}
+	if ledger := parseLedger(cm.Data[LedgerKey]); len(ledger) != 1 {
+		t.Errorf("Expected the ledger to hold only the last fault, but found %v", ledger)
+	}
+
+	if _, err := New(fkubernetes.NewSimpleClientset(), "chaos").Acquire(Fault{Namespace: "lanthanides"}); err != nil {
+		t.Errorf("Expected every fault to be allowed without a budget, but found %v", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	now := time.Date(2018, 1, 8, 14, 0, 0, 0, time.UTC)
+	clientset := fkubernetes.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: ConfigMap, Namespace: "chaos"},
+		Data:       map[string]string{MaxFaultsPerNamespaceKey: "1"},
+	})
+	b := New(clientset, "chaos")
+	b.now = func() time.Time { return now }
+
+	fault, err := b.Acquire(Fault{Namespace: "lanthanides", Pod: "cerium-1"})
+	if err != nil {
+		t.Fatalf("Expected the first fault to be allowed, but found %v", err)
+	}
+	if _, err := b.Acquire(Fault{Namespace: "lanthanides", Pod: "cerium-2"}); !IsDenied(err) {
+		t.Errorf("Expected the second fault to be denied, but found %v", err)
+	}
+	if err := b.Release(fault); err != nil {
+		t.Fatalf("Found unexpected error when releasing fault: %v", err)
+	}
+	if _, err := b.Acquire(Fault{Namespace: "lanthanides", Pod: "cerium-2"}); err != nil {
+		t.Errorf("Expected a fault to be allowed once the first was released, but found %v", err)
+	}
+	if err := b.Release(fault); err != nil {
+		t.Errorf("Found unexpected error when releasing a fault twice: %v", err)
+	}
+	cm, err := clientset.Core().ConfigMaps("chaos").Get(ConfigMap)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting ConfigMap: %v", err)
+	}
+	if ledger := parseLedger(cm.Data[LedgerKey]); len(ledger) != 1 || ledger[0].Pod != "cerium-2" {
+		t.Errorf("Expected the ledger to hold only the fault on cerium-2, but found %v", ledger)
+	}
+}
+
+func TestAcquireUnavailable(t *testing.T) {
+	deleted := unversioned.Now()
+	objects := []runtime.Object{&v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: ConfigMap, Namespace: "chaos"},
+		Data:       map[string]string{MaxUnavailablePerOwnerKey: "2"},
+	}}
+	for _, pod := range []v1.Pod{
+		ownedPod("cerium-1", "cerium", true),
+		ownedPod("cerium-2", "cerium", false),
+		ownedPod("cerium-3", "cerium", true),
+		ownedPod("cerium-4", "cerium", true),
+		ownedPod("erbium-1", "erbium", false),
+		ownedPod("erbium-2", "erbium", true),
+	} {
+		pod := pod
+		if pod.ObjectMeta.Name == "cerium-3" {
+			pod.ObjectMeta.DeletionTimestamp = &deleted
+		}
+		objects = append(objects, &pod)
+	}
+	b := New(fkubernetes.NewSimpleClientset(objects...), "chaos")
+
+	tests := map[string]struct {
+		pod, owner string
+		denied     bool
+	}{
+		// cerium-2 is not ready and cerium-3 is terminating.
+		"AtLimit":           {"cerium-1", "ReplicaSet/cerium", true},
+		"VictimUnavailable": {"cerium-2", "ReplicaSet/cerium", false},
+		"BelowLimit":        {"erbium-2", "ReplicaSet/erbium", false},
+		"NoOwner":           {"orphan", "", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := b.Acquire(Fault{Namespace: "lanthanides", Pod: test.pod, Owner: test.owner})
+			if test.denied && (!IsDenied(err) || err.(*DeniedError).Limit != MaxUnavailablePerOwnerKey) {
+				t.Errorf("Expected the fault to be denied by %v, but found %v", MaxUnavailablePerOwnerKey, err)
+			} else if !test.denied && err != nil {
+				t.Errorf("Expected the fault to be allowed, but found %v", err)
+			}
+		})
+	}
+}
+
+// ownedPod returns a pod in the lanthanides namespace owned by the
+// ReplicaSet with the given name.
+func ownedPod(name, owner string, ready bool) v1.Pod {
+	controller := true
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return v1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            name,
+			Namespace:       "lanthanides",
+			OwnerReferences: []v1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: &controller}},
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
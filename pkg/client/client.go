@@ -0,0 +1,152 @@
+// Package client implements a client for reading and writing FaultInjector
+// resources, which are not known to the generated Kubernetes clientset.
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/version"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/runtime/serializer"
+	"k8s.io/client-go/1.5/rest"
+)
+
+// Resource is the plural resource name of FaultInjectors in the API.
+const Resource = "faultinjectors"
+
+// Interface can read and write FaultInjector resources.
+type Interface interface {
+	List(namespace string) (*spec.FaultInjectorList, error)
+	Get(namespace, name string) (*spec.FaultInjector, error)
+	Create(obj *spec.FaultInjector) (*spec.FaultInjector, error)
+	Update(obj *spec.FaultInjector) (*spec.FaultInjector, error)
+	UpdateStatus(obj *spec.FaultInjector) (*spec.FaultInjector, error)
+	Delete(namespace, name string) error
+}
+
+type faultInjectors struct {
+	client *rest.RESTClient
+}
+
+// New creates a new FaultInjector client from a Kubernetes client config.
+func New(cfg rest.Config) (Interface, error) {
+	cfg.APIPath = "/apis"
+	cfg.GroupVersion = &unversioned.GroupVersion{
+		Group:   spec.GroupName,
+		Version: version.ResourceAPIVersion,
+	}
+	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
+
+	client, err := rest.RESTClientFor(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &faultInjectors{client: client}, nil
+}
+
+// List retrieves all FaultInjectors in a namespace, or in every namespace if
+// namespace is api.NamespaceAll.
+func (c *faultInjectors) List(namespace string) (*spec.FaultInjectorList, error) {
+	b, err := c.client.Get().
+		Namespace(namespace).
+		Resource(Resource).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result spec.FaultInjectorList
+	return &result, json.Unmarshal(b, &result)
+}
+
+// Get retrieves a single FaultInjector.
+func (c *faultInjectors) Get(namespace, name string) (*spec.FaultInjector, error) {
+	b, err := c.client.Get().
+		Namespace(namespace).
+		Resource(Resource).
+		Name(name).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result spec.FaultInjector
+	return &result, json.Unmarshal(b, &result)
+}
+
+// Create creates a new FaultInjector. Its status is ignored.
+func (c *faultInjectors) Create(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.client.Post().
+		Namespace(obj.ObjectMeta.Namespace).
+		Resource(Resource).
+		Body(body).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result spec.FaultInjector
+	return &result, json.Unmarshal(b, &result)
+}
+
+// Update replaces a FaultInjector. Its status is ignored, unless the API
+// server does not serve the status subresource. The update fails with a
+// conflict if obj is not the latest version of the FaultInjector.
+func (c *faultInjectors) Update(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	return c.put(obj)
+}
+
+// UpdateStatus replaces the status of a FaultInjector, leaving the rest of it
+// unchanged. The update fails with a conflict if obj is not the latest
+// version of the FaultInjector.
+//
+// API servers before Kubernetes 1.11 do not serve the status subresource, so
+// updating it fails as if the FaultInjector did not exist. If the
+// FaultInjector does exist, the whole of obj is written instead.
+func (c *faultInjectors) UpdateStatus(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	result, err := c.put(obj, "status")
+	if !apierrors.IsNotFound(err) {
+		return result, err
+	}
+	if _, getErr := c.Get(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name); apierrors.IsNotFound(getErr) {
+		return nil, err
+	} else if getErr != nil {
+		return nil, getErr
+	}
+	return c.put(obj)
+}
+
+// Delete deletes a FaultInjector. Its finalizers still run before it is
+// removed.
+func (c *faultInjectors) Delete(namespace, name string) error {
+	return c.client.Delete().
+		Namespace(namespace).
+		Resource(Resource).
+		Name(name).
+		Do().
+		Error()
+}
+
+func (c *faultInjectors) put(obj *spec.FaultInjector, subresources ...string) (*spec.FaultInjector, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.client.Put().
+		Namespace(obj.ObjectMeta.Namespace).
+		Resource(Resource).
+		Name(obj.ObjectMeta.Name).
+		SubResource(subresources...).
+		Body(body).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	var result spec.FaultInjector
+	return &result, json.Unmarshal(b, &result)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/version"
+
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/rest"
+)
+
+func TestGet(t *testing.T) {
+	path := "/apis/" + spec.GroupName + "/" + version.ResourceAPIVersion + "/namespaces/lanthanides/faultinjectors/cerium"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != path {
+			t.Errorf("Expected GET %v, but found %v %v", path, r.Method, r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(&spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "lanthanides"},
+			Status:     spec.FaultInjectorStatus{TotalFaults: 3},
+		})
+	}))
+	defer server.Close()
+
+	c, err := New(rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Found unexpected error when creating client: %v", err)
+	}
+	obj, err := c.Get("lanthanides", "cerium")
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	if obj.ObjectMeta.Name != "cerium" || obj.Status.TotalFaults != 3 {
+		t.Errorf("Found unexpected FaultInjector %v", obj)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	path := "/apis/" + spec.GroupName + "/" + version.ResourceAPIVersion + "/namespaces/lanthanides/faultinjectors/cerium"
+	conflict := false
+	expectedPath := path
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != expectedPath {
+			t.Errorf("Expected PUT %v, but found %v %v", expectedPath, r.Method, r.URL.Path)
+		}
+		if conflict {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apierrors.NewConflict(
+				unversioned.GroupResource{Group: spec.GroupName, Resource: Resource}, "cerium", nil).Status())
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Found unexpected error when reading request: %v", err)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	c, err := New(rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Found unexpected error when creating client: %v", err)
+	}
+	obj := &spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "lanthanides"},
+		Status:     spec.FaultInjectorStatus{Phase: spec.FaultInjectorRunning},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		result, err := c.Update(obj)
+		if err != nil {
+			t.Fatalf("Found unexpected error when updating FaultInjector: %v", err)
+		}
+		if result.Status.Phase != spec.FaultInjectorRunning {
+			t.Errorf("Expected phase %v, but found %v", spec.FaultInjectorRunning, result.Status.Phase)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		expectedPath = path + "/status"
+		if _, err := c.UpdateStatus(obj); err != nil {
+			t.Fatalf("Found unexpected error when updating FaultInjector status: %v", err)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		expectedPath = path
+		conflict = true
+		if _, err := c.Update(obj); !apierrors.IsConflict(err) {
+			t.Errorf("Expected a conflict error, but found %v", err)
+		}
+	})
+}
+
+func TestUpdateStatusFallback(t *testing.T) {
+	path := "/apis/" + spec.GroupName + "/" + version.ResourceAPIVersion + "/namespaces/lanthanides/faultinjectors/cerium"
+	exists := true
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path == path+"/status" || !exists {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apierrors.NewNotFound(
+				unversioned.GroupResource{Group: spec.GroupName, Resource: Resource}, "cerium").Status())
+			return
+		}
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(&spec.FaultInjector{
+				ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "lanthanides"},
+			})
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Found unexpected error when reading request: %v", err)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	c, err := New(rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Found unexpected error when creating client: %v", err)
+	}
+	obj := &spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "lanthanides"},
+		Status:     spec.FaultInjectorStatus{TotalFaults: 3},
+	}
+
+	t.Run("NoSubresource", func(t *testing.T) {
+		requests = nil
+		result, err := c.UpdateStatus(obj)
+		if err != nil {
+			t.Fatalf("Found unexpected error when updating FaultInjector status: %v", err)
+		}
+		if result.Status.TotalFaults != 3 {
+			t.Errorf("Expected 3 total faults, but found %v", result.Status.TotalFaults)
+		}
+		expected := []string{"PUT " + path + "/status", "GET " + path, "PUT " + path}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("Expected requests %v, but found %v", expected, requests)
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		exists = false
+		if _, err := c.UpdateStatus(obj); !apierrors.IsNotFound(err) {
+			t.Errorf("Expected a not found error, but found %v", err)
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	path := "/apis/" + spec.GroupName + "/" + version.ResourceAPIVersion + "/namespaces/lanthanides/faultinjectors/cerium"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != path {
+			t.Errorf("Expected DELETE %v, but found %v %v", path, r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&unversioned.Status{Status: unversioned.StatusSuccess})
+	}))
+	defer server.Close()
+
+	c, err := New(rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Found unexpected error when creating client: %v", err)
+	}
+	if err := c.Delete("lanthanides", "cerium"); err != nil {
+		t.Errorf("Found unexpected error when deleting FaultInjector: %v", err)
+	}
+}
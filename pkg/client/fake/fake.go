@@ -0,0 +1,159 @@
+// Package fake implements an in-memory FaultInjector client for testing.
+package fake
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/client"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+)
+
+var resource = unversioned.GroupResource{Group: spec.GroupName, Resource: client.Resource}
+
+// Client is an in-memory implementation of client.Interface. It tracks
+// resource versions so that stale updates fail with a conflict, and treats
+// status as a subresource like the API server does.
+type Client struct {
+	lock    sync.Mutex
+	objects map[string]*spec.FaultInjector
+	version int
+}
+
+var _ client.Interface = &Client{}
+
+// New creates a fake client holding copies of the given FaultInjectors.
+func New(objects ...*spec.FaultInjector) *Client {
+	c := &Client{objects: make(map[string]*spec.FaultInjector)}
+	for _, obj := range objects {
+		c.Add(obj)
+	}
+	return c
+}
+
+// Add stores a copy of a FaultInjector, including its status, replacing any
+// existing one.
+func (c *Client) Add(obj *spec.FaultInjector) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.store(obj)
+}
+
+// List retrieves copies of the FaultInjectors in a namespace, or in every
+// namespace if namespace is api.NamespaceAll, sorted by key.
+func (c *Client) List(namespace string) (*spec.FaultInjectorList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var keys []string
+	for key, obj := range c.objects {
+		if namespace == api.NamespaceAll || obj.ObjectMeta.Namespace == namespace {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := &spec.FaultInjectorList{
+		ListMeta: unversioned.ListMeta{ResourceVersion: strconv.Itoa(c.version)},
+	}
+	for _, key := range keys {
+		obj := *c.objects[key]
+		result.Items = append(result.Items, &obj)
+	}
+	return result, nil
+}
+
+// Get retrieves a copy of a single FaultInjector.
+func (c *Client) Get(namespace, name string) (*spec.FaultInjector, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	obj, ok := c.objects[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource, name)
+	}
+	result := *obj
+	return &result, nil
+}
+
+// Create stores a new FaultInjector without its status.
+func (c *Client) Create(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.objects[key(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)]; ok {
+		return nil, apierrors.NewAlreadyExists(resource, obj.ObjectMeta.Name)
+	}
+	created := *obj
+	created.Status = spec.FaultInjectorStatus{}
+	result := *c.store(&created)
+	return &result, nil
+}
+
+// Update replaces a FaultInjector, except for its status, if its resource
+// version is current.
+func (c *Client) Update(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, err := c.current(obj)
+	if err != nil {
+		return nil, err
+	}
+	updated := *obj
+	updated.Status = existing.Status
+	result := *c.store(&updated)
+	return &result, nil
+}
+
+// UpdateStatus replaces the status of a FaultInjector if its resource
+// version is current.
+func (c *Client) UpdateStatus(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, err := c.current(obj)
+	if err != nil {
+		return nil, err
+	}
+	updated := *existing
+	updated.Status = obj.Status
+	result := *c.store(&updated)
+	return &result, nil
+}
+
+// Delete removes a FaultInjector. Unlike the API server, it ignores
+// finalizers.
+func (c *Client) Delete(namespace, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.objects[key(namespace, name)]; !ok {
+		return apierrors.NewNotFound(resource, name)
+	}
+	delete(c.objects, key(namespace, name))
+	return nil
+}
+
+// current returns the stored FaultInjector with the same name as obj, or an
+// error if there is none or obj is stale.
+func (c *Client) current(obj *spec.FaultInjector) (*spec.FaultInjector, error) {
+	existing, ok := c.objects[key(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(resource, obj.ObjectMeta.Name)
+	}
+	if obj.ObjectMeta.ResourceVersion != existing.ObjectMeta.ResourceVersion {
+		return nil, apierrors.NewConflict(resource, obj.ObjectMeta.Name, nil)
+	}
+	return existing, nil
+}
+
+func (c *Client) store(obj *spec.FaultInjector) *spec.FaultInjector {
+	c.version++
+	stored := *obj
+	stored.ObjectMeta.ResourceVersion = strconv.Itoa(c.version)
+	c.objects[key(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)] = &stored
+	return &stored
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
@@ -5,15 +5,24 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/puppetlabs/fault-injector-controller/pkg/apiextensions"
+	"github.com/puppetlabs/fault-injector-controller/pkg/client"
+	"github.com/puppetlabs/fault-injector-controller/pkg/leaderelection"
 	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/pkg/workqueue"
 	"github.com/puppetlabs/fault-injector-controller/version"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/client-go/1.5/kubernetes"
+	v1core "k8s.io/client-go/1.5/kubernetes/typed/core/v1"
 	"k8s.io/client-go/1.5/pkg/api"
 	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
 	"k8s.io/client-go/1.5/pkg/api/unversioned"
@@ -22,38 +31,92 @@ import (
 	"k8s.io/client-go/1.5/pkg/labels"
 	"k8s.io/client-go/1.5/pkg/runtime"
 	"k8s.io/client-go/1.5/pkg/runtime/serializer"
-	"k8s.io/client-go/1.5/pkg/selection"
-	"k8s.io/client-go/1.5/pkg/util/sets"
 	"k8s.io/client-go/1.5/pkg/util/wait"
 	"k8s.io/client-go/1.5/pkg/watch"
 	"k8s.io/client-go/1.5/rest"
 	"k8s.io/client-go/1.5/tools/cache"
+	"k8s.io/client-go/1.5/tools/record"
 )
 
 var (
-	tprGroup   = "k8s.puppet.com"
-	tprVersion = version.ResourceAPIVersion
-	tprKind    = "faultinjectors"
-
-	tprName = "fault-injector." + tprGroup
-
 	imagePrefix = version.ImageRepo
 )
 
+const (
+	// maxRetries is the number of times syncing a FaultInjector is retried
+	// before it is dropped from the work queue until its next change.
+	maxRetries = 15
+	// teardownPollInterval is how often the controller checks whether the
+	// injectors of a deleted FaultInjector have stopped.
+	teardownPollInterval = 2 * time.Second
+	// retryBaseDelay and retryMaxDelay bound the exponential backoff between
+	// retries.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 5 * time.Minute
+	// leaderElectionLock is the name of the ConfigMap used as the leader
+	// election lock.
+	leaderElectionLock = "fault-injector-controller"
+	// serviceAccountNamespaceFile holds the namespace of the controller when
+	// it runs in a cluster.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
 // FaultInjectorController manages TypeInjector resources.
 type FaultInjectorController struct {
 	// TODO: proper configuration
-	kclient    kubernetes.Interface
-	ficlient   *rest.RESTClient
-	store      cache.Store
-	controller cache.ControllerInterface
+	kclient        kubernetes.Interface
+	ficlient       *rest.RESTClient
+	faultInjectors client.Interface
+	crdclient      apiextensions.Interface
+	store          cache.Store
+	controller     cache.ControllerInterface
+	deployments    cache.ControllerInterface
+	policies       cache.ControllerInterface
+	recorder       record.EventRecorder
+	queue          *workqueue.Queue
+	workers        int
+	requireOptIn   bool
+	resyncPeriod   time.Duration
+	// budgetNamespace is passed to the injectors as the namespace of the
+	// budget ConfigMap.
+	budgetNamespace string
+	elector         *leaderelection.LeaderElector
+	runErr          error
+	// policy is the parsed policy ConfigMap, and policyTimer queues every
+	// FaultInjector when the next blackout starts or ends.
+	policyLock  sync.RWMutex
+	policy      *policy
+	policyTimer *time.Timer
+	// leading and synced are set atomically to 1 once this replica becomes
+	// the leader, and once its informers have synced.
+	leading int32
+	synced  int32
 }
 
 // Config holds configuration parameters for a FaultInjectorController.
 type Config struct {
-	Host        string
-	TLSInsecure bool
-	TLSConfig   rest.TLSClientConfig
+	Host         string
+	TLSInsecure  bool
+	TLSConfig    rest.TLSClientConfig
+	RequireOptIn bool
+	Workers      int
+	ResyncPeriod time.Duration
+	// LeaderElect makes replicas of the controller elect a leader, and only
+	// the leader reconcile FaultInjectors.
+	LeaderElect bool
+	// LeaderElectNamespace is the namespace of the leader election lock.
+	// Defaults to the namespace the controller runs in.
+	LeaderElectNamespace string
+	// LeaderElectIdentity identifies this replica in the leader election.
+	LeaderElectIdentity string
+	LeaseDuration       time.Duration
+	RenewDeadline       time.Duration
+	RetryPeriod         time.Duration
+	// PolicyNamespace is the namespace of the policy ConfigMap which
+	// suspends every FaultInjector, and of the budget ConfigMap which limits
+	// the faults injected by every injector. Defaults to the namespace the
+	// controller runs in.
+	PolicyNamespace string
 }
 
 type jsonFaultInjectorDecoder struct {
@@ -81,7 +144,16 @@ func New(conf Config) (*FaultInjectorController, error) {
 	var cfg *rest.Config
 	var err error
 
-	c := &FaultInjectorController{}
+	if conf.Workers < 1 {
+		return nil, fmt.Errorf("Worker count must be positive, but got %v", conf.Workers)
+	}
+
+	c := &FaultInjectorController{
+		queue:        workqueue.New(retryBaseDelay, retryMaxDelay),
+		workers:      conf.Workers,
+		requireOptIn: conf.RequireOptIn,
+		resyncPeriod: conf.ResyncPeriod,
+	}
 
 	if len(conf.Host) == 0 {
 		cfg, err = rest.InClusterConfig()
@@ -102,16 +174,32 @@ func New(conf Config) (*FaultInjectorController, error) {
 		}
 	}
 
+	faultInjectors, err := client.New(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.faultInjectors = faultInjectors
+
+	crdclient, err := apiextensions.New(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.crdclient = crdclient
+
 	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
 	c.kclient = client
 
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.Core().Events("")})
+	c.recorder = eventBroadcaster.NewRecorder(v1.EventSource{Component: "fault-injector-controller"})
+
 	cfg.APIPath = "/apis"
 	cfg.GroupVersion = &unversioned.GroupVersion{
-		Group:   tprGroup,
-		Version: tprVersion,
+		Group:   spec.GroupName,
+		Version: version.ResourceAPIVersion,
 	}
 	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
 
@@ -121,52 +209,133 @@ func New(conf Config) (*FaultInjectorController, error) {
 	}
 	c.ficlient = ficlient
 
-	lw := prepareListWatch(client, ficlient)
+	lw := prepareListWatch(faultInjectors, ficlient)
 	resourceHandler := cache.ResourceEventHandlerFuncs{
 		AddFunc:    c.handleAddFaultInjector,
 		DeleteFunc: c.handleDeleteFaultInjector,
 		UpdateFunc: c.handleUpdateFaultInjector,
 	}
-	store, controller := cache.NewInformer(lw, &spec.FaultInjector{}, 0, resourceHandler)
+	store, controller := cache.NewInformer(lw, &spec.FaultInjector{}, conf.ResyncPeriod, resourceHandler)
 	c.store = store
 	c.controller = controller
+	c.deployments = c.newDeploymentInformer(conf.ResyncPeriod)
+	policyNamespace := conf.PolicyNamespace
+	if len(policyNamespace) == 0 {
+		policyNamespace = inClusterNamespace()
+	}
+	c.policies = c.newPolicyInformer(policyNamespace, conf.ResyncPeriod)
+	c.budgetNamespace = policyNamespace
+	if err := prometheus.Register(faultInjectorCollector{store: store}); err != nil {
+		return nil, err
+	}
+
+	if conf.LeaderElect {
+		namespace := conf.LeaderElectNamespace
+		if len(namespace) == 0 {
+			namespace = inClusterNamespace()
+		}
+		c.elector, err = leaderelection.New(client, leaderelection.Config{
+			Namespace:     namespace,
+			Name:          leaderElectionLock,
+			Identity:      conf.LeaderElectIdentity,
+			LeaseDuration: conf.LeaseDuration,
+			RenewDeadline: conf.RenewDeadline,
+			RetryPeriod:   conf.RetryPeriod,
+			OnStartedLeading: func(stop <-chan struct{}) {
+				atomic.StoreInt32(&c.leading, 1)
+				c.runErr = c.run(stop)
+			},
+			OnStoppedLeading: func() {
+				fmt.Printf("%v stopped leading\n", conf.LeaderElectIdentity)
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return c, nil
 }
 
-// Run starts the FaultInjector controller service.
+// inClusterNamespace returns the namespace the controller runs in, or the
+// default namespace when it runs outside a cluster.
+func inClusterNamespace() string {
+	b, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return api.NamespaceDefault
+	}
+	if namespace := strings.TrimSpace(string(b)); len(namespace) > 0 {
+		return namespace
+	}
+	return api.NamespaceDefault
+}
+
+// Run starts the FaultInjector controller service. With leader election, it
+// waits until this replica becomes the leader, and returns an error if it
+// stops being the leader before stopChan is closed. Once stopChan is closed,
+// Run returns after the workers have drained the work queue.
 func (c *FaultInjectorController) Run(stopChan <-chan struct{}) error {
-	err := c.createTPR()
+	if c.elector == nil {
+		return c.run(stopChan)
+	}
+	c.elector.Run(stopChan)
+	if c.runErr != nil {
+		return c.runErr
+	}
+	select {
+	case <-stopChan:
+		return nil
+	default:
+		return fmt.Errorf("Lost leadership")
+	}
+}
+
+// Ready returns whether the controller has registered the FaultInjector
+// resource and listed every FaultInjector and Deployment. A replica standing
+// by for leadership is always ready.
+func (c *FaultInjectorController) Ready() bool {
+	if c.elector != nil && atomic.LoadInt32(&c.leading) == 0 {
+		return true
+	}
+	return atomic.LoadInt32(&c.synced) == 1
+}
+
+func (c *FaultInjectorController) run(stopChan <-chan struct{}) error {
+	err := c.createCRD(stopChan)
 	if err != nil {
 		return err
 	}
 
-	err = c.prepareInitialStore()
+	go c.controller.Run(stopChan)
+	go c.deployments.Run(stopChan)
+	go c.policies.Run(stopChan)
+	err = wait.PollUntil(100*time.Millisecond, func() (bool, error) {
+		return c.controller.HasSynced() && c.deployments.HasSynced() && c.policies.HasSynced(), nil
+	}, stopChan)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&c.synced, 1)
+	defer atomic.StoreInt32(&c.synced, 0)
+	err = c.collectOrphans()
 	if err != nil {
 		return err
 	}
-	c.controller.Run(stopChan)
+	c.runWorkers(stopChan)
 	return nil
 }
 
-func prepareListWatch(kclient *kubernetes.Clientset, ficlient *rest.RESTClient) *cache.ListWatch {
+func prepareListWatch(faultInjectors client.Interface, ficlient *rest.RESTClient) *cache.ListWatch {
 	return &cache.ListWatch{
 		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
-			req := ficlient.Get().
-				Namespace(api.NamespaceAll).
-				Resource(tprKind)
-			b, err := req.DoRaw()
-			if err != nil {
-				return nil, err
-			}
-			var l spec.FaultInjectorList
-			return &l, json.Unmarshal(b, &l)
+			return faultInjectors.List(api.NamespaceAll)
 		},
 		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
 			req := ficlient.Get().
 				Prefix("watch").
 				Namespace(api.NamespaceAll).
-				Resource(tprKind)
+				Resource(client.Resource).
+				Param("resourceVersion", options.ResourceVersion)
 			stream, err := req.Stream()
 			if err != nil {
 				return nil, err
@@ -179,149 +348,472 @@ func prepareListWatch(kclient *kubernetes.Clientset, ficlient *rest.RESTClient)
 	}
 }
 
-func (c *FaultInjectorController) prepareInitialStore() error {
-	selector := labels.NewSelector()
-	requirement, err := labels.NewRequirement("generatedBy", selection.Equals, sets.NewString("FaultInjector"))
-	if err != nil {
-		return err
+// collectOrphans deletes the Deployments whose FaultInjector no longer exists,
+// e.g. because it was deleted while the controller was down, and queues the
+// FaultInjectors whose Deployment is out of date. It must be called once the
+// informer has listed every FaultInjector.
+func (c *FaultInjectorController) collectOrphans() error {
+	owners := make(map[string]*spec.FaultInjector)
+	for _, obj := range c.store.List() {
+		obj := obj.(*spec.FaultInjector)
+		owners[obj.ObjectMeta.Namespace+"/"+obj.ObjectMeta.Name] = obj
 	}
-	selector = selector.Add(*requirement)
+
 	listOptions := api.ListOptions{
-		LabelSelector: selector,
+		LabelSelector: labels.SelectorFromSet(labels.Set{spec.GeneratedByLabel: spec.GeneratedByValue}),
 	}
-	deployments, err := c.kclient.Extensions().Deployments(v1.NamespaceAll).List(listOptions)
+	deployments, err := c.kclient.Extensions().Deployments(api.NamespaceAll).List(listOptions)
 	if err != nil {
 		return err
 	}
 	for i := range deployments.Items {
-		name := strings.SplitN(deployments.Items[i].ObjectMeta.Name, "-", 2)
-		if name[0] != "faultinjector" {
-			return fmt.Errorf("Found an existing deployment that does not match expected name format: %v", deployments.Items[i].ObjectMeta.Name)
+		deployment := &deployments.Items[i]
+		name, ok := parseDownstreamName(deployment.ObjectMeta.Name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Ignoring Deployment %v/%v, whose name does not match the expected format\n",
+				deployment.ObjectMeta.Namespace, deployment.ObjectMeta.Name)
+			continue
 		}
-		specType := spec.FaultInjectorType(deployments.Items[i].Spec.Template.ObjectMeta.Labels["faultinjector-type"])
-		resourceLabels := deployments.Items[i].Spec.Template.ObjectMeta.Labels
-		delete(resourceLabels, "faultinjector-type")
-		resource := &spec.FaultInjector{
-			ObjectMeta: v1.ObjectMeta{
-				Name:      name[1],
-				Namespace: deployments.Items[i].ObjectMeta.Namespace,
-				Labels:    resourceLabels,
-			},
-			Spec: spec.FaultInjectorSpec{
-				Type: specType,
-			},
+		key := deployment.ObjectMeta.Namespace + "/" + name
+		if owner, ok := owners[key]; ok && isOwnedBy(deployment, owner) {
+			if deployment.ObjectMeta.Annotations[spec.SpecHashAnnotation] != specHash(c.effectiveFaultInjector(owner)) {
+				fmt.Printf("Deployment %v/%v is out of date with its FaultInjector\n", deployment.ObjectMeta.Namespace, deployment.ObjectMeta.Name)
+				c.queue.Add(key)
+			}
+			continue
+		}
+		fmt.Printf("Deleting Deployment %v/%v, whose FaultInjector no longer exists\n", deployment.ObjectMeta.Namespace, deployment.ObjectMeta.Name)
+		orphanDependents := false
+		err := c.kclient.Extensions().Deployments(deployment.ObjectMeta.Namespace).Delete(deployment.ObjectMeta.Name, &api.DeleteOptions{OrphanDependents: &orphanDependents})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
 		}
-		c.store.Add(resource)
 	}
 	return nil
 }
 
-func (c *FaultInjectorController) handleAddFaultInjector(obj interface{}) {
-	var newObj *spec.FaultInjector
-	newObj = obj.(*spec.FaultInjector)
-	err := c.addFaultInjector(newObj)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+// isOwnedBy returns whether a Deployment belongs to a FaultInjector with the
+// same name. Deployments created before owner references were set belong to
+// any such FaultInjector.
+func isOwnedBy(deployment *extensionsobj.Deployment, obj *spec.FaultInjector) bool {
+	for _, owner := range deployment.ObjectMeta.OwnerReferences {
+		if owner.Kind == spec.Kind {
+			return owner.UID == obj.ObjectMeta.UID
+		}
 	}
+	return true
+}
+
+func (c *FaultInjectorController) handleAddFaultInjector(obj interface{}) {
+	c.enqueue(obj)
 }
 
 func (c *FaultInjectorController) handleDeleteFaultInjector(obj interface{}) {
-	var newObj *spec.FaultInjector
-	switch obj.(type) {
-	case *spec.FaultInjector:
-		newObj = obj.(*spec.FaultInjector)
-	case cache.DeletedFinalStateUnknown:
-		newObj = obj.(cache.DeletedFinalStateUnknown).Obj.(*spec.FaultInjector)
+	c.enqueue(obj)
+}
+
+func (c *FaultInjectorController) handleUpdateFaultInjector(old, cur interface{}) {
+	c.enqueue(cur)
+}
+
+// newDeploymentInformer returns an informer which queues the FaultInjector
+// owning a Deployment whenever the Deployment changes, so that changes made
+// to it by anyone else are undone.
+func (c *FaultInjectorController) newDeploymentInformer(resyncPeriod time.Duration) cache.ControllerInterface {
+	selector := labels.SelectorFromSet(labels.Set{spec.GeneratedByLabel: spec.GeneratedByValue})
+	lw := &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return c.kclient.Extensions().Deployments(api.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return c.kclient.Extensions().Deployments(api.NamespaceAll).Watch(options)
+		},
 	}
+	_, controller := cache.NewInformer(lw, &extensionsobj.Deployment{}, resyncPeriod, cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.handleDeployment,
+		DeleteFunc: c.handleDeployment,
+		UpdateFunc: func(old, cur interface{}) { c.handleDeployment(cur) },
+	})
+	return controller
+}
 
-	err := c.deleteFaultInjector(newObj)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+// handleDeployment queues the FaultInjector owning a Deployment.
+func (c *FaultInjectorController) handleDeployment(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	deployment, ok := obj.(*extensionsobj.Deployment)
+	if !ok {
+		return
+	}
+	name, ok := parseDownstreamName(deployment.ObjectMeta.Name)
+	if !ok {
+		return
 	}
+	c.queue.Add(deployment.ObjectMeta.Namespace + "/" + name)
 }
 
-func (c *FaultInjectorController) handleUpdateFaultInjector(old, cur interface{}) {
-	var newObj *spec.FaultInjector
-	newObj = cur.(*spec.FaultInjector)
-	err := c.addFaultInjector(newObj)
+// enqueue adds the key of a FaultInjector, or of the tombstone of a deleted
+// FaultInjector, to the work queue.
+func (c *FaultInjectorController) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Error when queueing FaultInjector %#v: %v\n", obj, err)
+		return
 	}
+	c.queue.Add(key)
 }
 
-func (c *FaultInjectorController) addFaultInjector(newObj *spec.FaultInjector) error {
-	var err error
-	downstreamObj := c.getDownstreamState(newObj)
+// runWorkers processes the work queue with the configured number of workers
+// until stopChan is closed, then waits for the workers to drain the queue.
+func (c *FaultInjectorController) runWorkers(stopChan <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(c.runWorker, time.Second, stopChan)
+		}()
+	}
+	<-stopChan
+	c.queue.ShutDown()
+	wg.Wait()
+}
 
-	if downstreamObj == nil {
-		downstreamObj, err = generateDownstreamObject(newObj)
+func (c *FaultInjectorController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem syncs the next key in the work queue, and requeues it
+// with backoff if syncing failed. It returns false once the queue is shut down.
+func (c *FaultInjectorController) processNextWorkItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	err := c.Reconcile(key)
+	observeReconcile(start, err)
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+	if c.queue.NumRequeues(key) < maxRetries {
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Giving up on FaultInjector %v after %v retries: %v\n", key, maxRetries, err)
+	c.queue.Forget(key)
+	return true
+}
+
+// Reconcile brings the Deployment of the FaultInjector with the given key in
+// line with the FaultInjector, recreating it if it is missing and undoing any
+// changes made to it, or deletes it if the FaultInjector no longer exists or
+// is outside of its lifetime.
+func (c *FaultInjectorController) Reconcile(key string) error {
+	obj, exists, err := c.store.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
 		if err != nil {
 			return err
 		}
-		downstreamObj, err = c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Create(downstreamObj)
+		deletedObj := &spec.FaultInjector{
+			TypeMeta: unversioned.TypeMeta{
+				Kind:       spec.Kind,
+				APIVersion: spec.GroupName + "/" + version.ResourceAPIVersion,
+			},
+			ObjectMeta: v1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+		}
+		err = c.deleteFaultInjector(deletedObj)
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			c.recorder.Eventf(deletedObj, v1.EventTypeWarning, "DeleteFailed", "Error when deleting FaultInjector: %v", err)
 		}
-	} else {
-		err = updateDownstreamObject(downstreamObj, newObj)
+		return err
+	}
+
+	newObj := obj.(*spec.FaultInjector)
+	if newObj.ObjectMeta.DeletionTimestamp != nil {
+		return c.teardown(key, newObj)
+	}
+	if err := c.ensureFinalizer(newObj); err != nil {
+		return err
+	}
+
+	created := c.getDownstreamState(newObj) == nil
+	err = c.syncFaultInjector(key, newObj)
+	refused, isRefusal := err.(*refusal)
+	if isRefusal {
+		// A refusal is only reported when it first occurs, as retrying it
+		// would not change the outcome.
+		if conditionReason(newObj.Status.Conditions, spec.FaultInjectorAccepted) != refused.reason {
+			fmt.Fprintln(os.Stderr, err)
+			c.recorder.Event(newObj, v1.EventTypeWarning, refused.reason, refused.message)
+		}
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if created {
+			c.recorder.Eventf(newObj, v1.EventTypeWarning, "CreateFailed", "Error when creating FaultInjector: %v", err)
+		} else {
+			c.recorder.Eventf(newObj, v1.EventTypeWarning, "UpdateFailed", "Error when updating FaultInjector: %v", err)
+		}
+	}
+	statusErr := c.updateStatus(newObj, err)
+	if statusErr != nil {
+		fmt.Fprintln(os.Stderr, statusErr)
+	}
+	if isRefusal || err == nil {
+		err = statusErr
+	}
+	return err
+}
+
+// effectiveFaultInjector returns a FaultInjector with the settings enforced
+// by the controller applied.
+func (c *FaultInjectorController) effectiveFaultInjector(obj *spec.FaultInjector) *spec.FaultInjector {
+	if c.requireOptIn && !obj.Spec.OptIn {
+		optInObj := *obj
+		optInObj.Spec.OptIn = true
+		return &optInObj
+	}
+	return obj
+}
+
+// addFaultInjector creates or updates the Deployment of a FaultInjector. A
+// FaultInjector in a namespace which has not opted in is refused: its
+// Deployment is not created, and an existing one is scaled down, and the
+// refusal is returned once the Deployment is up to date.
+func (c *FaultInjectorController) addFaultInjector(newObj *spec.FaultInjector) error {
+	var err error
+	var refused *refusal
+	newObj = c.effectiveFaultInjector(newObj)
+	if newObj.Spec.OptIn {
+		refused, err = c.checkNamespaceOptIn(newObj)
 		if err != nil {
 			return err
 		}
-		downstreamObj, err = c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Update(downstreamObj)
-		if err != nil {
+	}
+	desiredObj, err := generateDownstreamObject(newObj)
+	if err != nil {
+		return err
+	}
+	setBudgetNamespace(desiredObj, c.budgetNamespace)
+	replicas := downstreamReplicas
+	suspension := c.suspension()
+	if suspension != nil || newObj.Spec.Paused || refused != nil {
+		replicas = 0
+	}
+	desiredObj.Spec.Replicas = &replicas
+	stateChanged := c.recordStateChanges(newObj, suspension)
+	// Scaling down a refused FaultInjector, or back up once it is accepted,
+	// is not drift.
+	wasRefused := conditionReason(newObj.Status.Conditions, spec.FaultInjectorAccepted) == namespaceNotOptedIn
+	if wasRefused != (refused != nil) {
+		stateChanged = true
+	}
+
+	downstreamObj := c.getDownstreamState(newObj)
+	if downstreamObj == nil {
+		if refused != nil {
+			return refused
+		}
+		if newObj.Status.Deployment != "" {
+			c.recordDrift(newObj, fmt.Sprintf("Recreating deleted Deployment %v", desiredObj.ObjectMeta.Name))
+		}
+		_, err = c.kclient.Extensions().Deployments(desiredObj.ObjectMeta.Namespace).Create(desiredObj)
+		return err
+	}
+
+	drift := downstreamDrift(downstreamObj, desiredObj)
+	if len(drift) == 0 {
+		return refused.orNil()
+	}
+	if stateChanged {
+		drift = removeString(drift, "replicas")
+	}
+	// The FaultInjector is unchanged since it was last reconciled, so the
+	// Deployment must have been changed by someone else.
+	if len(drift) > 0 && newObj.ObjectMeta.Generation > 0 && newObj.ObjectMeta.Generation == newObj.Status.ObservedGeneration {
+		c.recordDrift(newObj, fmt.Sprintf("Correcting %v of Deployment %v", strings.Join(drift, ", "), downstreamObj.ObjectMeta.Name))
+	}
+	err = updateDownstreamObject(downstreamObj, newObj)
+	if err != nil {
+		return err
+	}
+	setBudgetNamespace(downstreamObj, c.budgetNamespace)
+	downstreamObj.Spec.Replicas = &replicas
+	_, err = c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Update(downstreamObj)
+	if err != nil {
+		return err
+	}
+	return refused.orNil()
+}
+
+// recordStateChanges records an event when a FaultInjector is paused,
+// suspended or resumed, as judged from the conditions of its last status. It
+// returns whether any event was recorded.
+func (c *FaultInjectorController) recordStateChanges(obj *spec.FaultInjector, suspension *suspension) bool {
+	wasPaused := conditionStatus(obj.Status.Conditions, spec.FaultInjectorPausedCondition) == v1.ConditionTrue
+	wasSuspended := conditionStatus(obj.Status.Conditions, spec.FaultInjectorSuspendedCondition) == v1.ConditionTrue
+	changed := false
+	if obj.Spec.Paused && !wasPaused {
+		c.recorder.Event(obj, v1.EventTypeNormal, "Paused", "Stopping injectors: spec.paused is set")
+		changed = true
+	}
+	if suspension != nil && !wasSuspended {
+		c.recorder.Eventf(obj, v1.EventTypeNormal, "Suspended", "Stopping injectors: %v", suspension.message)
+		changed = true
+	}
+	if (wasPaused || wasSuspended) && !obj.Spec.Paused && suspension == nil {
+		c.recorder.Event(obj, v1.EventTypeNormal, "Resumed", "Restarting injectors")
+		changed = true
+	}
+	return changed
+}
+
+// ensureFinalizer adds the controller's finalizer to a FaultInjector, so that
+// the controller gets to tear it down before it is deleted.
+func (c *FaultInjectorController) ensureFinalizer(obj *spec.FaultInjector) error {
+	for _, finalizer := range obj.ObjectMeta.Finalizers {
+		if finalizer == spec.Finalizer {
+			return nil
+		}
+	}
+	updated := *obj
+	updated.ObjectMeta.Finalizers = append(append([]string{}, obj.ObjectMeta.Finalizers...), spec.Finalizer)
+	_, err := c.faultInjectors.Update(&updated)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// teardown stops the injectors of a FaultInjector which is being deleted. It
+// first scales the Deployment down and requeues the FaultInjector until every
+// injector has stopped, then deletes the Deployment, records the final number
+// of faults injected and removes the finalizer, letting the deletion finish.
+func (c *FaultInjectorController) teardown(key string, obj *spec.FaultInjector) error {
+	if err := c.updateStatus(obj, nil); err != nil {
+		return err
+	}
+	downstreamObj := c.getDownstreamState(obj)
+	if downstreamObj != nil {
+		if downstreamObj.Spec.Replicas == nil || *downstreamObj.Spec.Replicas != 0 {
+			fmt.Printf("Stopping injectors of FaultInjector %v\n", key)
+			replicas := int32(0)
+			downstreamObj.Spec.Replicas = &replicas
+			_, err := c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Update(downstreamObj)
+			if err != nil {
+				return err
+			}
+			c.queue.AddAfter(key, teardownPollInterval)
+			return nil
+		}
+		if downstreamObj.Status.Replicas > 0 {
+			c.queue.AddAfter(key, teardownPollInterval)
+			return nil
+		}
+		if err := c.deleteFaultInjector(obj); err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 	}
-	downstreamObj = c.getDownstreamState(newObj)
+
+	latest, err := c.faultInjectors.Get(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var finalizers []string
+	for _, finalizer := range latest.ObjectMeta.Finalizers {
+		if finalizer != spec.Finalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if len(finalizers) == len(latest.ObjectMeta.Finalizers) {
+		return nil
+	}
+	c.recorder.Eventf(latest, v1.EventTypeNormal, "TornDown", "Stopped injecting faults after %v faults", latest.Status.TotalFaults)
+	latest.ObjectMeta.Finalizers = finalizers
+	_, err = c.faultInjectors.Update(latest)
 	return err
 }
 
+// recordDrift reports a change made to the Deployment of a FaultInjector
+// outside of the controller, which the controller is about to undo.
+func (c *FaultInjectorController) recordDrift(obj *spec.FaultInjector, message string) {
+	fmt.Printf("FaultInjector %v/%v: %v\n", obj.ObjectMeta.Namespace, obj.ObjectMeta.Name, message)
+	c.recorder.Event(obj, v1.EventTypeNormal, "DriftCorrected", message)
+}
+
 func (c *FaultInjectorController) deleteFaultInjector(obj *spec.FaultInjector) error {
 	downstreamObj := c.getDownstreamState(obj)
 	if downstreamObj != nil {
-		err := c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Delete(downstreamObj.ObjectMeta.Name, &api.DeleteOptions{})
+		// Deployments in extensions/v1beta1 orphan their ReplicaSets by default.
+		orphanDependents := false
+		err := c.kclient.Extensions().Deployments(downstreamObj.ObjectMeta.Namespace).Delete(downstreamObj.ObjectMeta.Name, &api.DeleteOptions{OrphanDependents: &orphanDependents})
 		return err
 	}
 	return nil
 }
 
-func (c *FaultInjectorController) getDownstreamState(obj *spec.FaultInjector) *extensionsobj.Deployment {
-	deployment, err := c.kclient.Extensions().Deployments(obj.ObjectMeta.Namespace).Get(formatDownstreamName(obj))
-	if err != nil {
+// namespaceNotOptedIn is the reason given for refusing a FaultInjector in
+// opt-in mode whose namespace has not opted in.
+const namespaceNotOptedIn = "NamespaceNotOptedIn"
+
+// refusal is returned when the controller refuses to run a FaultInjector.
+// Unlike other errors it is not retried, since it only goes away once the
+// FaultInjector or its namespace change, which requeues the FaultInjector.
+type refusal struct {
+	reason, message string
+}
+
+func (r *refusal) Error() string {
+	return r.message
+}
+
+// orNil returns the refusal as an error, or nil if there is none, so that a
+// nil refusal is not returned as a non-nil error.
+func (r *refusal) orNil() error {
+	if r == nil {
 		return nil
 	}
-	return deployment
+	return r
 }
 
-// Create the FaultInjector ThirdPartyResource in kubernetes.
-func (c *FaultInjectorController) createTPR() error {
-	fmt.Println("Creating ThirdPartyResource")
-	tpr := &extensionsobj.ThirdPartyResource{
-		ObjectMeta: v1.ObjectMeta{
-			Name: tprName,
-		},
-		Versions: []extensionsobj.APIVersion{
-			{
-				Name: tprVersion,
-			},
-		},
-		Description: "A specification for a fault injection task to run against the service",
+// checkNamespaceOptIn returns a refusal if the namespace of a FaultInjector
+// in opt-in mode has not opted in to fault injection.
+func (c *FaultInjectorController) checkNamespaceOptIn(obj *spec.FaultInjector) (*refusal, error) {
+	namespace, err := c.kclient.Core().Namespaces().Get(obj.ObjectMeta.Namespace)
+	if err != nil {
+		return nil, err
 	}
-
-	tprClient := c.kclient.Extensions().ThirdPartyResources()
-
-	if _, err := tprClient.Create(tpr); err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+	if !spec.IsOptedIn(namespace.ObjectMeta) {
+		return &refusal{
+			reason: namespaceNotOptedIn,
+			message: fmt.Sprintf("Refusing to run FaultInjector %v: namespace %v has not opted in with %v=true",
+				obj.ObjectMeta.Name, obj.ObjectMeta.Namespace, spec.OptInMarker),
+		}, nil
 	}
+	return nil, nil
+}
 
-	err := wait.Poll(3*time.Second, 30*time.Second, func() (bool, error) {
-		fmt.Println("Checking that TPR was created")
-		_, err := c.kclient.Extensions().ThirdPartyResources().Get(tprName)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
-	})
-
-	return err
+func (c *FaultInjectorController) getDownstreamState(obj *spec.FaultInjector) *extensionsobj.Deployment {
+	deployment, err := c.kclient.Extensions().Deployments(obj.ObjectMeta.Namespace).Get(formatDownstreamName(obj))
+	if err != nil {
+		return nil
+	}
+	return deployment
 }
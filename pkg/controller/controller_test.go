@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	fapiextensions "github.com/puppetlabs/fault-injector-controller/pkg/apiextensions/fake"
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/leaderelection"
 	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
-	"github.com/puppetlabs/fault-injector-controller/version"
+	"github.com/puppetlabs/fault-injector-controller/pkg/workqueue"
 
 	"strings"
 
@@ -18,9 +22,12 @@ import (
 	"k8s.io/client-go/1.5/pkg/api/unversioned"
 	"k8s.io/client-go/1.5/pkg/api/v1"
 	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	"k8s.io/client-go/1.5/pkg/types"
 	ktesting "k8s.io/client-go/1.5/testing"
 	"k8s.io/client-go/1.5/tools/cache"
 	fcache "k8s.io/client-go/1.5/tools/cache/testing"
+	"k8s.io/client-go/1.5/tools/record"
 )
 
 type resourceEvent struct {
@@ -36,58 +43,84 @@ type resourceEventTest struct {
 	dest      *fkubernetes.Clientset
 }
 
-func TestPrepareInitialStore(t *testing.T) {
+func TestCollectOrphans(t *testing.T) {
 	c, _ := prepareResourceHandlerTest()
-	clientset := c.kclient
-	store := c.store
+	clientset := c.kclient.(*fkubernetes.Clientset)
 
-	sources, err := generateTestFaultInjectors(3)
+	sources, err := generateTestFaultInjectors(5)
 	if err != nil {
 		t.Fatalf("Found unexpected error when generating test cases: %v", err)
 	}
 	for i := range sources {
+		sources[i].ObjectMeta.UID = types.UID(fmt.Sprintf("uid-%v", i))
 		deployment, err := generateDownstreamObject(sources[i])
 		if err != nil {
 			t.Fatalf("Found unexpected error when preparing test cases: %v", err)
 		}
-		clientset.Extensions().Deployments(v1.NamespaceDefault).Create(deployment)
+		clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Create(deployment)
 	}
-	otherDeployment := &extensionsobj.Deployment{
-		ObjectMeta: v1.ObjectMeta{
-			Name:      "NotFaultInjector",
-			Namespace: v1.NamespaceDefault,
-			Labels:    map[string]string{"generatedBy": "foobar"},
+	// * sources[0] is unchanged.
+	// * sources[1] was changed while the controller was down.
+	// * sources[2] was deleted while the controller was down.
+	// * sources[3] was deleted and recreated while the controller was down.
+	// * sources[4] was deleted, and its Deployment predates owner references.
+	sources[1].Spec.KillCount = 2
+	sources[3].ObjectMeta.UID = "uid-recreated"
+	legacyDeployment := c.getDownstreamState(sources[4])
+	legacyDeployment.ObjectMeta.OwnerReferences = nil
+	legacyDeployment.ObjectMeta.Annotations = nil
+	clientset.Extensions().Deployments(legacyDeployment.ObjectMeta.Namespace).Update(legacyDeployment)
+	for _, obj := range []*spec.FaultInjector{sources[0], sources[1], sources[3]} {
+		c.store.Add(obj)
+	}
+
+	otherDeployments := []*extensionsobj.Deployment{
+		{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "NotFaultInjector",
+				Namespace: v1.NamespaceDefault,
+				Labels:    map[string]string{"generatedBy": "foobar"},
+			},
 		},
-		Spec: extensionsobj.DeploymentSpec{
-			Template: v1.PodTemplateSpec{
-				ObjectMeta: v1.ObjectMeta{},
-				Spec: v1.PodSpec{
-					Containers: []v1.Container{
-						{Name: "foo", Image: "gcr.io/google-samples/gb-frontend:v4"},
-					},
-				},
+		{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "unexpected-name",
+				Namespace: v1.NamespaceDefault,
+				Labels:    map[string]string{"generatedBy": "FaultInjector"},
 			},
 		},
 	}
-	clientset.Extensions().Deployments(v1.NamespaceDefault).Create(otherDeployment)
+	for _, deployment := range otherDeployments {
+		clientset.Extensions().Deployments(v1.NamespaceDefault).Create(deployment)
+	}
 
-	err = c.prepareInitialStore()
+	err = c.collectOrphans()
 	if err != nil {
-		t.Fatalf("Found unexpected error when preparing initial store: %v", err)
+		t.Fatalf("Found unexpected error when collecting orphans: %v", err)
 	}
 
-	rawActualResources := store.List()
-	actualDeployments := make([]*extensionsobj.Deployment, len(rawActualResources))
-	for i := range rawActualResources {
-		resource := rawActualResources[i].(*spec.FaultInjector)
-		deployment, err := generateDownstreamObject(resource)
-		if err != nil {
-			t.Errorf("When generating deployment from object in store:\n%v\nfound unexpected error:\n%v\n", resource, err)
-		} else {
-			actualDeployments[i] = deployment
+	deployments := getDeploymentList(clientset, t)
+	if len(deployments) != 4 {
+		t.Errorf("Expected 4 deployments to be left, but found %v", len(deployments))
+	}
+	validateSingleResourcePresent(t, deployments, sources[0])
+	for _, deleted := range []*spec.FaultInjector{sources[2], sources[3], sources[4]} {
+		if c.getDownstreamState(deleted) != nil {
+			t.Errorf("Expected the orphaned deployment of %v to be deleted", deleted.ObjectMeta.Name)
 		}
 	}
-	validateResourceList(t, actualDeployments, sources)
+	for _, deployment := range otherDeployments {
+		if _, err := clientset.Extensions().Deployments(v1.NamespaceDefault).Get(deployment.ObjectMeta.Name); err != nil {
+			t.Errorf("Expected deployment %v to be left alone, but found %v", deployment.ObjectMeta.Name, err)
+		}
+	}
+
+	if c.queue.Len() != 1 {
+		t.Fatalf("Expected exactly one queued key, but found %v", c.queue.Len())
+	}
+	if key, _ := c.queue.Get(); key != "test-namespace-two/thorium" {
+		t.Errorf("Expected the changed FaultInjector to be queued, but found %v", key)
+	}
 }
 
 func TestGetDownstreamState(t *testing.T) {
@@ -203,6 +236,562 @@ func TestAddFaultInjector(t *testing.T) {
 	})
 }
 
+func TestAddFaultInjectorOptIn(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+
+	namespace, err := clientset.Core().Namespaces().Get("test-namespace-two")
+	if err != nil {
+		t.Fatalf("Error when preparing namespaces for test: %v", err)
+	}
+	namespace.ObjectMeta.Labels = map[string]string{spec.OptInMarker: "true"}
+	if _, err := clientset.Core().Namespaces().Update(namespace); err != nil {
+		t.Fatalf("Error when preparing namespaces for test: %v", err)
+	}
+
+	sources, err := generateTestFaultInjectors(2)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	for i := range sources {
+		sources[i].Spec.OptIn = true
+	}
+
+	t.Run("NamespaceNotOptedIn", func(t *testing.T) {
+		err = c.addFaultInjector(sources[0])
+		if _, ok := err.(*refusal); !ok {
+			t.Errorf("Expected a refusal when adding resource to a namespace which has not opted in, but found %v", err)
+		}
+		deployments := getDeploymentList(clientset, t)
+		validateResourceList(t, deployments, nil)
+	})
+
+	t.Run("NamespaceOptedIn", func(t *testing.T) {
+		err = c.addFaultInjector(sources[1])
+		if err != nil {
+			t.Errorf("Found unexpected error when adding resource: %v", err)
+		}
+		deployments := getDeploymentList(clientset, t)
+		validateResourceList(t, deployments, sources[1:])
+	})
+
+	t.Run("RequireOptIn", func(t *testing.T) {
+		c.requireOptIn = true
+		sources[0].Spec.OptIn = false
+		err = c.addFaultInjector(sources[0])
+		if _, ok := err.(*refusal); !ok {
+			t.Errorf("Expected a refusal when adding resource to a namespace which has not opted in, but found %v", err)
+		}
+		deployments := getDeploymentList(clientset, t)
+		validateResourceList(t, deployments, sources[1:])
+	})
+
+	t.Run("OptInRemoved", func(t *testing.T) {
+		namespace.ObjectMeta.Labels = nil
+		if _, err := clientset.Core().Namespaces().Update(namespace); err != nil {
+			t.Fatalf("Error when preparing namespaces for test: %v", err)
+		}
+		err = c.addFaultInjector(sources[1])
+		if _, ok := err.(*refusal); !ok {
+			t.Errorf("Expected a refusal when the namespace no longer opts in, but found %v", err)
+		}
+		deployment := c.getDownstreamState(sources[1])
+		if deployment == nil || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0 {
+			t.Errorf("Expected the deployment to be scaled down, but found %v", deployment)
+		}
+	})
+}
+
+func TestReconcileEvents(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	recorder := record.NewFakeRecorder(3)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	c.store.Add(sources[0])
+	failingVerb := ""
+	clientset.PrependReactor("*", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() != failingVerb {
+			return false, nil, nil
+		}
+		return true, nil, fmt.Errorf("Deployment %v failed", failingVerb)
+	})
+
+	failingVerb = "create"
+	if err := c.Reconcile(key); err == nil {
+		t.Errorf("Expected an error when the deployment cannot be created")
+	}
+	failingVerb = ""
+	if err := c.Reconcile(key); err != nil {
+		t.Errorf("Found unexpected error when syncing resource: %v", err)
+	}
+	deployment := c.getDownstreamState(sources[0])
+	deployment.Spec.Template.Spec.Containers[0].Image = "busybox"
+	if _, err := clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Update(deployment); err != nil {
+		t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+	}
+	failingVerb = "update"
+	if err := c.Reconcile(key); err == nil {
+		t.Errorf("Expected an error when the deployment cannot be updated")
+	}
+
+	failingVerb = "delete"
+	c.store.Delete(sources[0])
+	if err := c.Reconcile(key); err == nil {
+		t.Errorf("Expected an error when the deployment cannot be deleted")
+	}
+
+	validateEvents(t, recorder, "Warning CreateFailed", "Warning UpdateFailed", "Warning DeleteFailed")
+}
+
+func TestReconcileOptIn(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	sources[0].Spec.OptIn = true
+	faultInjectors.Add(sources[0])
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	reconcile := func(t *testing.T, optIn string) *spec.FaultInjector {
+		namespace, err := clientset.Core().Namespaces().Get("test-namespace-one")
+		if err != nil {
+			t.Fatalf("Error when preparing namespaces for test: %v", err)
+		}
+		namespace.ObjectMeta.Labels = map[string]string{spec.OptInMarker: optIn}
+		if _, err := clientset.Core().Namespaces().Update(namespace); err != nil {
+			t.Fatalf("Error when preparing namespaces for test: %v", err)
+		}
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		c.store.Update(obj)
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		obj, err = faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		return obj
+	}
+	validateRefused := func(t *testing.T, obj *spec.FaultInjector) {
+		if obj.Status.Phase != spec.FaultInjectorFailed ||
+			conditionStatus(obj.Status.Conditions, spec.FaultInjectorAccepted) != v1.ConditionFalse ||
+			conditionReason(obj.Status.Conditions, spec.FaultInjectorAccepted) != namespaceNotOptedIn {
+			t.Errorf("Expected the FaultInjector to be refused, but found status %+v", obj.Status)
+		}
+	}
+
+	obj := reconcile(t, "false")
+	validateRefused(t, obj)
+	validateResourceList(t, getDeploymentList(clientset, t), nil)
+	validateEvents(t, recorder, "Warning NamespaceNotOptedIn Refusing to run FaultInjector")
+
+	// The refusal is only reported once.
+	reconcile(t, "false")
+	validateEvents(t, recorder)
+
+	obj = reconcile(t, "true")
+	if conditionStatus(obj.Status.Conditions, spec.FaultInjectorAccepted) != v1.ConditionTrue {
+		t.Errorf("Expected the FaultInjector to be accepted, but found status %+v", obj.Status)
+	}
+	validateResourceList(t, getDeploymentList(clientset, t), sources)
+	validateEvents(t, recorder)
+
+	// Removing the opt-in stops the injectors which are already running.
+	obj = reconcile(t, "false")
+	validateRefused(t, obj)
+	deployment := c.getDownstreamState(sources[0])
+	if deployment == nil || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0 {
+		t.Errorf("Expected the deployment to be scaled down, but found %v", deployment)
+	}
+	validateEvents(t, recorder, "Warning NamespaceNotOptedIn Refusing to run FaultInjector")
+}
+
+func TestReconcileDrift(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	recorder := record.NewFakeRecorder(2)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	c.store.Add(sources[0])
+	if err := c.Reconcile(key); err != nil {
+		t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+	}
+	// Pretend that the status written by the controller was observed.
+	sources[0].ObjectMeta.Generation = 1
+	sources[0].Status.ObservedGeneration = 1
+	sources[0].Status.Deployment = formatDownstreamName(sources[0])
+
+	countUpdates := func() int {
+		count := 0
+		for _, action := range clientset.Fake.Actions() {
+			if action.GetVerb() == "update" && action.GetResource().Resource == "deployments" {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("NoDrift", func(t *testing.T) {
+		updates := countUpdates()
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		if countUpdates() != updates {
+			t.Errorf("Expected no update of a deployment without drift")
+		}
+	})
+
+	t.Run("Edited", func(t *testing.T) {
+		deployment := c.getDownstreamState(sources[0])
+		replicas := int32(3)
+		deployment.Spec.Replicas = &replicas
+		deployment.Spec.Template.Spec.Containers[0].Image = "busybox"
+		if _, err := clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Update(deployment); err != nil {
+			t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+		}
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		validateResourceList(t, getDeploymentList(clientset, t), sources)
+		deployment = c.getDownstreamState(sources[0])
+		if *deployment.Spec.Replicas != 1 {
+			t.Errorf("Expected drift in replicas to be corrected, but found %v replicas", *deployment.Spec.Replicas)
+		}
+		validateEvents(t, recorder, "Normal DriftCorrected Correcting replicas, image of Deployment")
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		if err := c.deleteFaultInjector(sources[0]); err != nil {
+			t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+		}
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		validateResourceList(t, getDeploymentList(clientset, t), sources)
+		validateEvents(t, recorder, "Normal DriftCorrected Recreating deleted Deployment")
+	})
+}
+
+func TestReconcileFinalizer(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	sources[0].ObjectMeta.UID = "8d3f0c52-7a64-4b5e-a1f2-6c0e9b7d4a38"
+	faultInjectors.Add(sources[0])
+	obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	c.store.Add(obj)
+
+	if err := c.Reconcile("test-namespace-one/" + sources[0].ObjectMeta.Name); err != nil {
+		t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+	}
+	obj, err = faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	if !reflect.DeepEqual(obj.ObjectMeta.Finalizers, []string{spec.Finalizer}) {
+		t.Errorf("Expected the finalizer %v to be added, but found %v", spec.Finalizer, obj.ObjectMeta.Finalizers)
+	}
+
+	deployment := c.getDownstreamState(sources[0])
+	if deployment == nil {
+		t.Fatalf("Expected a deployment to be created")
+	}
+	owners := deployment.ObjectMeta.OwnerReferences
+	if len(owners) != 1 || owners[0].UID != sources[0].ObjectMeta.UID || owners[0].Kind != spec.Kind ||
+		owners[0].Controller == nil || !*owners[0].Controller {
+		t.Errorf("Expected the deployment to be controlled by the FaultInjector, but found owners %v", owners)
+	}
+}
+
+func TestReconcilePaused(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	sources[0].Status.TotalFaults = 7
+	faultInjectors.Add(sources[0])
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	reconcile := func(t *testing.T, paused bool) *spec.FaultInjector {
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		obj.Spec.Paused = paused
+		if obj, err = faultInjectors.Update(obj); err != nil {
+			t.Fatalf("Found unexpected error when updating FaultInjector: %v", err)
+		}
+		c.store.Update(obj)
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		obj, err = faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		return obj
+	}
+	validateReplicas := func(t *testing.T, expected int32) {
+		deployment := c.getDownstreamState(sources[0])
+		if deployment == nil || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != expected {
+			t.Errorf("Expected the deployment to have %v replicas, but found %v", expected, deployment)
+		}
+	}
+
+	reconcile(t, false)
+	validateReplicas(t, downstreamReplicas)
+	validateEvents(t, recorder)
+
+	obj := reconcile(t, true)
+	validateReplicas(t, 0)
+	if obj.Status.Phase != spec.FaultInjectorPaused || conditionStatus(obj.Status.Conditions, spec.FaultInjectorPausedCondition) != v1.ConditionTrue {
+		t.Errorf("Expected the FaultInjector to be paused, but found status %+v", obj.Status)
+	}
+	if obj.Status.TotalFaults != 7 {
+		t.Errorf("Expected the fault history to be kept, but found %v total faults", obj.Status.TotalFaults)
+	}
+	validateEvents(t, recorder, "Normal Paused Stopping injectors: spec.paused is set")
+
+	reconcile(t, true)
+	validateReplicas(t, 0)
+	validateEvents(t, recorder)
+
+	obj = reconcile(t, false)
+	validateReplicas(t, downstreamReplicas)
+	if obj.Status.Phase == spec.FaultInjectorPaused || conditionStatus(obj.Status.Conditions, spec.FaultInjectorPausedCondition) != v1.ConditionFalse {
+		t.Errorf("Expected the FaultInjector to be resumed, but found status %+v", obj.Status)
+	}
+	validateEvents(t, recorder, "Normal Resumed Restarting injectors")
+}
+
+func TestReconcileTeardown(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+	recorder := record.NewFakeRecorder(1)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	deployment, err := generateDownstreamObject(sources[0])
+	if err != nil {
+		t.Fatalf("Found unexpected error when generating deployment: %v", err)
+	}
+	deployment.Status.Replicas = 1
+	if _, err := clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Create(deployment); err != nil {
+		t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+	}
+
+	now := unversioned.Now()
+	sources[0].ObjectMeta.DeletionTimestamp = &now
+	sources[0].ObjectMeta.Finalizers = []string{"example.com/other", spec.Finalizer}
+	sources[0].Status.TotalFaults = 7
+	faultInjectors.Add(sources[0])
+	obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	c.store.Add(obj)
+
+	t.Run("Stopping", func(t *testing.T) {
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		deployment = c.getDownstreamState(sources[0])
+		if deployment == nil {
+			t.Fatalf("Expected the deployment to be kept until its injectors stopped")
+		}
+		if *deployment.Spec.Replicas != 0 {
+			t.Errorf("Expected the deployment to be scaled down, but found %v replicas", *deployment.Spec.Replicas)
+		}
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		if obj.Status.Phase != spec.FaultInjectorTerminating {
+			t.Errorf("Expected phase %v, but found %v", spec.FaultInjectorTerminating, obj.Status.Phase)
+		}
+		if len(obj.ObjectMeta.Finalizers) != 2 {
+			t.Errorf("Expected the finalizer to be kept until the injectors stopped, but found %v", obj.ObjectMeta.Finalizers)
+		}
+		validateEvents(t, recorder)
+	})
+
+	t.Run("Stopped", func(t *testing.T) {
+		deployment.Status.Replicas = 0
+		if _, err := clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Update(deployment); err != nil {
+			t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+		}
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		validateResourceList(t, getDeploymentList(clientset, t), nil)
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		if !reflect.DeepEqual(obj.ObjectMeta.Finalizers, []string{"example.com/other"}) {
+			t.Errorf("Expected only the controller's finalizer to be removed, but found %v", obj.ObjectMeta.Finalizers)
+		}
+		validateEvents(t, recorder, "Normal TornDown Stopped injecting faults after 7 faults")
+	})
+}
+
+func TestHandleDeployment(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	deployment, err := generateDownstreamObject(sources[0])
+	if err != nil {
+		t.Fatalf("Found unexpected error when generating deployment: %v", err)
+	}
+
+	c.handleDeployment(deployment)
+	c.handleDeployment(cache.DeletedFinalStateUnknown{Key: "test-namespace-one/faultinjector-actinium", Obj: deployment})
+	deployment.ObjectMeta.Name = "unrelated"
+	c.handleDeployment(deployment)
+
+	if c.queue.Len() != 1 {
+		t.Fatalf("Expected exactly one queued key, but found %v", c.queue.Len())
+	}
+	if key, _ := c.queue.Get(); key != "test-namespace-one/actinium" {
+		t.Errorf("Expected the owning FaultInjector to be queued, but found %v", key)
+	}
+}
+
+func TestProcessNextWorkItemRetry(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+
+	failures := 2
+	clientset.PrependReactor("create", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.New("Deployment creation failed")
+		}
+		return false, nil, nil
+	})
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	c.store.Add(sources[0])
+	c.handleAddFaultInjector(sources[0])
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.runWorkers(stop)
+
+	time.Sleep(time.Second)
+	deployments := getDeploymentList(clientset, t)
+	validateResourceList(t, deployments, sources)
+	if requeues := c.queue.NumRequeues("test-namespace-one/" + sources[0].ObjectMeta.Name); requeues != 0 {
+		t.Errorf("Expected the retries to be forgotten after a successful sync, but found %v", requeues)
+	}
+}
+
+func TestRunWorkersDrain(t *testing.T) {
+	count := 3
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	sources, err := generateTestFaultInjectors(count)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	for _, source := range sources {
+		c.store.Add(source)
+		c.handleAddFaultInjector(source)
+	}
+
+	// Hold the first Deployment creation until the workers have been stopped.
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	clientset.PrependReactor("create", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+		once.Do(func() {
+			close(entered)
+			<-release
+		})
+		return false, nil, nil
+	})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runWorkers(stop)
+	}()
+	<-entered
+	close(stop)
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the workers to return once the queue was drained")
+	}
+	if c.queue.Len() != 0 {
+		t.Errorf("Expected the work queue to be drained, but found %v keys", c.queue.Len())
+	}
+	validateResourceList(t, getDeploymentList(clientset, t), sources)
+}
+
+func TestReady(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	if c.Ready() {
+		t.Errorf("Expected the controller not to be ready before syncing")
+	}
+	c.synced = 1
+	if !c.Ready() {
+		t.Errorf("Expected the controller to be ready once synced")
+	}
+
+	c.elector = &leaderelection.LeaderElector{}
+	c.synced = 0
+	if !c.Ready() {
+		t.Errorf("Expected a replica standing by for leadership to be ready")
+	}
+	c.leading = 1
+	if c.Ready() {
+		t.Errorf("Expected the leader not to be ready before syncing")
+	}
+}
+
 func TestDeleteFaultInjector(t *testing.T) {
 	count := 2
 
@@ -245,6 +834,7 @@ func TestAddResourceHandlerFuncs(t *testing.T) {
 	defer close(stop)
 
 	go controller.Run(stop)
+	go c.runWorkers(stop)
 
 	sources, err := generateTestFaultInjectors(3)
 	if err != nil {
@@ -295,6 +885,7 @@ func TestDeleteResourceHandlerFunc(t *testing.T) {
 	defer close(stop)
 
 	go controller.Run(stop)
+	go c.runWorkers(stop)
 
 	sources, err := generateTestFaultInjectors(3)
 	if err != nil {
@@ -378,6 +969,7 @@ func TestControllerRun(t *testing.T) {
 	for _, resource := range sources[2:] {
 		source.Add(resource)
 	}
+
 	source.AddDropWatch(sources[0])
 	rawList, err := source.List(api.ListOptions{})
 	if err != nil {
@@ -438,33 +1030,6 @@ func TestControllerRun(t *testing.T) {
 	})
 }
 
-func TestCreateTPR(t *testing.T) {
-	expectedResource := unversioned.GroupVersionResource{
-		Group:    "extensions",
-		Version:  "v1beta1",
-		Resource: "thirdpartyresources",
-	}
-
-	c, _ := prepareResourceHandlerTest()
-	clientset := c.kclient.(*fkubernetes.Clientset)
-	c.createTPR()
-
-	actions := clientset.Fake.Actions()
-	// We create two namespaces in prepareResourceHandlerTest(): skip those.
-	firstAction, actions := actions[2], actions[3:]
-	if firstAction.GetVerb() != "create" {
-		t.Error("Expected to create the FaultInjector ThirdPartyResource first, but did not.")
-	} else if res := firstAction.GetResource(); res != expectedResource {
-		t.Error("Expected to create a ThirdPartyResource but created", res)
-	} else if tpr := firstAction.(ktesting.CreateAction).GetObject().(*extensionsobj.ThirdPartyResource); tpr.ObjectMeta.Name != "fault-injector.k8s.puppet.com" {
-		t.Error("Expected to create a ThirdPartyResource for fault-injector.k8s.puppet.com, but created", tpr.ObjectMeta.Name)
-	} else if tpr := firstAction.(ktesting.CreateAction).GetObject().(*extensionsobj.ThirdPartyResource); len(tpr.Versions) != 1 {
-		t.Error("Expected FaultInjector ThirdPartyResource to have exactly one version but got", len(tpr.Versions))
-	} else if tpr := firstAction.(ktesting.CreateAction).GetObject().(*extensionsobj.ThirdPartyResource); tpr.Versions[0].Name != version.ResourceAPIVersion {
-		t.Error("Expected FaultInjector ThirdPartyResource to be version", version.ResourceAPIVersion, "but got", tpr.Versions[0].Name)
-	}
-}
-
 func getDeploymentList(clientset *fkubernetes.Clientset, t *testing.T) []*extensionsobj.Deployment {
 	var out []*extensionsobj.Deployment
 	deployments, err := clientset.Extensions().Deployments(v1.NamespaceAll).List(api.ListOptions{})
@@ -519,11 +1084,35 @@ func generateTestFaultInjectors(count int) ([]*spec.FaultInjector, error) {
 	return tests, nil
 }
 
+// validateEvents checks that the events recorded by a FakeRecorder begin with each of the expected prefixes, in order.
+func validateEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+	for _, prefix := range expected {
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, prefix) {
+				t.Errorf("Expected event starting with %q, but found %q", prefix, event)
+			}
+		default:
+			t.Errorf("Expected event starting with %q, but found none", prefix)
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Found unexpected event %q", event)
+	default:
+	}
+}
+
 func prepareResourceHandlerTest() (*FaultInjectorController, *fcache.FakeControllerSource) {
 	var clientset *fkubernetes.Clientset
 	clientset = fkubernetes.NewSimpleClientset()
 	c := &FaultInjectorController{
-		kclient: clientset,
+		kclient:        clientset,
+		faultInjectors: ffaultinjectors.New(),
+		crdclient:      fapiextensions.New(),
+		recorder:       &record.FakeRecorder{},
+		queue:          workqueue.New(time.Millisecond, 10*time.Millisecond),
+		workers:        2,
 	}
 
 	clientset.Core().Namespaces().Create(&v1.Namespace{
@@ -549,6 +1138,8 @@ func prepareResourceHandlerTest() (*FaultInjectorController, *fcache.FakeControl
 
 	c.store = store
 	c.controller = controller
+	c.deployments = c.newDeploymentInformer(time.Millisecond * 100)
+	c.policies = c.newPolicyInformer(v1.NamespaceDefault, time.Millisecond*100)
 
 	return c, source
 }
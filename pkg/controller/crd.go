@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/apiextensions"
+	"github.com/puppetlabs/fault-injector-controller/pkg/client"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/version"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/util/wait"
+)
+
+// crdEstablishTimeout is how long the controller waits for the API server to
+// establish the CustomResourceDefinition.
+const crdEstablishTimeout = 30 * time.Second
+
+var (
+	crdName = client.Resource + "." + spec.GroupName
+	// tprName is the name of the ThirdPartyResource which registered the
+	// FaultInjector resource before CustomResourceDefinitions existed.
+	tprName = "fault-injector." + spec.GroupName
+)
+
+// Create the FaultInjector CustomResourceDefinition in kubernetes, migrating
+// any FaultInjectors stored by an existing ThirdPartyResource. The
+// ThirdPartyResource is only deleted once every FaultInjector was restored.
+// Waiting for the definition to be established ends when stopChan is closed.
+func (c *FaultInjectorController) createCRD(stopChan <-chan struct{}) error {
+	fmt.Println("Creating CustomResourceDefinition")
+	tprObjects, err := c.listTPRObjects()
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.crdclient.Create(faultInjectorCRD()); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	deadline := time.Now().Add(crdEstablishTimeout)
+	err = wait.PollUntil(3*time.Second, func() (bool, error) {
+		fmt.Println("Checking that CRD was established")
+		crd, err := c.crdclient.Get(crdName)
+		if err != nil {
+			return false, err
+		}
+		if crd.IsEstablished() {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("CustomResourceDefinition %v was not established within %v", crdName, crdEstablishTimeout)
+		}
+		return false, nil
+	}, stopChan)
+	if err != nil {
+		return err
+	}
+
+	if tprObjects == nil {
+		return nil
+	}
+	if err := c.restoreTPRObjects(tprObjects); err != nil {
+		return err
+	}
+	fmt.Println("Deleting ThirdPartyResource")
+	err = c.kclient.Extensions().ThirdPartyResources().Delete(tprName, &api.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// listTPRObjects returns the FaultInjectors stored by the ThirdPartyResource,
+// or nil if there is no ThirdPartyResource to migrate.
+func (c *FaultInjectorController) listTPRObjects() ([]*spec.FaultInjector, error) {
+	_, err := c.kclient.Extensions().ThirdPartyResources().Get(tprName)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	list, err := c.faultInjectors.List(api.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("Error when listing FaultInjectors to migrate from ThirdPartyResource %v: %v", tprName, err)
+	}
+	fmt.Printf("Migrating %v FaultInjectors from ThirdPartyResource %v\n", len(list.Items), tprName)
+	return append([]*spec.FaultInjector{}, list.Items...), nil
+}
+
+// restoreTPRObjects creates each FaultInjector previously stored by the
+// ThirdPartyResource which the API server did not migrate by itself,
+// including its status.
+func (c *FaultInjectorController) restoreTPRObjects(objects []*spec.FaultInjector) error {
+	for _, obj := range objects {
+		_, err := c.faultInjectors.Get(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)
+		if err == nil {
+			continue
+		} else if !apierrors.IsNotFound(err) {
+			return err
+		}
+		restored := &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        obj.ObjectMeta.Name,
+				Namespace:   obj.ObjectMeta.Namespace,
+				Labels:      obj.ObjectMeta.Labels,
+				Annotations: obj.ObjectMeta.Annotations,
+			},
+			Spec:   obj.Spec,
+			Status: obj.Status,
+		}
+		restored.TypeMeta.Kind = spec.Kind
+		restored.TypeMeta.APIVersion = spec.GroupName + "/" + version.ResourceAPIVersion
+		created, err := c.faultInjectors.Create(restored)
+		if apierrors.IsAlreadyExists(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Error when migrating FaultInjector %v/%v: %v", obj.ObjectMeta.Namespace, obj.ObjectMeta.Name, err)
+		}
+		// The status of a new FaultInjector is dropped by API servers which
+		// serve the status subresource, and kept by those which do not serve
+		// it at all.
+		created.Status = obj.Status
+		if _, err := c.faultInjectors.UpdateStatus(created); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Error when migrating the status of FaultInjector %v/%v: %v", obj.ObjectMeta.Namespace, obj.ObjectMeta.Name, err)
+		}
+	}
+	return nil
+}
+
+// faultInjectorCRD returns the CustomResourceDefinition of the FaultInjector
+// resource. Its schema must be kept in sync with spec.FaultInjector.
+func faultInjectorCRD() *apiextensions.CustomResourceDefinition {
+	return &apiextensions.CustomResourceDefinition{
+		ObjectMeta: v1.ObjectMeta{
+			Name: crdName,
+		},
+		Spec: apiextensions.CustomResourceDefinitionSpec{
+			Group: spec.GroupName,
+			Names: apiextensions.CustomResourceDefinitionNames{
+				Plural:     client.Resource,
+				Singular:   "faultinjector",
+				ShortNames: []string{"fi"},
+				Kind:       spec.Kind,
+				ListKind:   spec.Kind + "List",
+			},
+			Scope:   apiextensions.NamespaceScoped,
+			Version: version.ResourceAPIVersion,
+			Validation: &apiextensions.CustomResourceValidation{
+				OpenAPIV3Schema: faultInjectorSchema(),
+			},
+			Subresources: &apiextensions.CustomResourceSubresources{
+				Status: &apiextensions.CustomResourceSubresourceStatus{},
+			},
+			AdditionalPrinterColumns: []apiextensions.CustomResourceColumnDefinition{
+				{Name: "Type", Type: "string", JSONPath: ".spec.type"},
+				{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+				{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+			},
+		},
+	}
+}
+
+func faultInjectorSchema() *apiextensions.JSONSchemaProps {
+	str := apiextensions.JSONSchemaProps{Type: "string"}
+	boolean := apiextensions.JSONSchemaProps{Type: "boolean"}
+	duration := apiextensions.JSONSchemaProps{Type: "string", Description: "A duration such as 1m or 30s."}
+	integer := func(format string, min, max *float64) apiextensions.JSONSchemaProps {
+		return apiextensions.JSONSchemaProps{Type: "integer", Format: format, Minimum: min, Maximum: max}
+	}
+	timeOfDay := apiextensions.JSONSchemaProps{Type: "string", Description: "A time of day such as 10:00."}
+	timestamp := apiextensions.JSONSchemaProps{Type: "string", Format: "date-time"}
+	zero, hundred := 0.0, 100.0
+
+	return &apiextensions.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensions.JSONSchemaProps{
+			"spec": {
+				Type: "object",
+				Properties: map[string]apiextensions.JSONSchemaProps{
+					"type": {Type: "string", Enum: []interface{}{"PodKiller"}},
+					"selector": {
+						Type: "object",
+						Properties: map[string]apiextensions.JSONSchemaProps{
+							"labelSelector": str,
+							"fieldSelector": str,
+						},
+					},
+					"interval":           duration,
+					"jitter":             duration,
+					"killCount":          integer("int32", &zero, nil),
+					"killPercent":        integer("int32", &zero, &hundred),
+					"optIn":              boolean,
+					"method":             {Type: "string", Enum: []interface{}{string(spec.KillMethodDelete), string(spec.KillMethodEvict), string(spec.KillMethodForceDelete)}},
+					"gracePeriodSeconds": integer("int64", &zero, nil),
+					"minAvailable":       {XIntOrString: true, Description: "A number of pods such as 2, or a percentage such as 50%."},
+					"dryRun":             boolean,
+					"paused":             boolean,
+					"schedule": {
+						Type: "object",
+						Properties: map[string]apiextensions.JSONSchemaProps{
+							"timeZone": {Type: "string", Description: "An IANA time zone name such as Europe/London."},
+							"cron":     {Type: "string", Description: "A cron expression of five fields."},
+							"windows": {
+								Type: "array",
+								Items: &apiextensions.JSONSchemaProps{
+									Type:     "object",
+									Required: []string{"start", "end"},
+									Properties: map[string]apiextensions.JSONSchemaProps{
+										"days":  {Type: "array", Items: &str},
+										"start": timeOfDay,
+										"end":   timeOfDay,
+									},
+								},
+							},
+						},
+					},
+					"startTime":                 timestamp,
+					"duration":                  duration,
+					"endTime":                   timestamp,
+					"ttlSecondsAfterCompletion": integer("int32", &zero, nil),
+				},
+			},
+			"status": {
+				Type: "object",
+				Properties: map[string]apiextensions.JSONSchemaProps{
+					"phase": str,
+					"conditions": {
+						Type: "array",
+						Items: &apiextensions.JSONSchemaProps{
+							Type:     "object",
+							Required: []string{"type", "status"},
+							Properties: map[string]apiextensions.JSONSchemaProps{
+								"type":               str,
+								"status":             str,
+								"lastTransitionTime": timestamp,
+								"reason":             str,
+								"message":            str,
+							},
+						},
+					},
+					"observedGeneration": integer("int64", nil, nil),
+					"deployment":         str,
+					"lastFaultTime":      timestamp,
+					"totalFaults":        integer("int64", nil, nil),
+					"deniedFaults":       integer("int64", nil, nil),
+					"completionTime":     timestamp,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/apiextensions"
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/version"
+
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	ktesting "k8s.io/client-go/1.5/testing"
+)
+
+func TestCreateCRD(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	if err := c.createCRD(make(chan struct{})); err != nil {
+		t.Fatalf("Found unexpected error when creating CRD: %v", err)
+	}
+
+	crd, err := c.crdclient.Get("faultinjectors.k8s.puppet.com")
+	if err != nil {
+		t.Fatalf("Expected to create a CustomResourceDefinition for faultinjectors.k8s.puppet.com, but found %v", err)
+	}
+	if crd.Spec.Group != spec.GroupName || crd.Spec.Names.Kind != spec.Kind || crd.Spec.Names.Plural != "faultinjectors" {
+		t.Errorf("Found unexpected CustomResourceDefinition names: %v %v", crd.Spec.Group, crd.Spec.Names)
+	}
+	if !reflect.DeepEqual(crd.Spec.Names.ShortNames, []string{"fi"}) {
+		t.Errorf("Expected short name fi, but found %v", crd.Spec.Names.ShortNames)
+	}
+	if crd.Spec.Version != version.ResourceAPIVersion {
+		t.Errorf("Expected FaultInjector CustomResourceDefinition to be version %v but got %v", version.ResourceAPIVersion, crd.Spec.Version)
+	}
+	if crd.Spec.Subresources == nil || crd.Spec.Subresources.Status == nil {
+		t.Errorf("Expected the status subresource to be enabled")
+	}
+	var columns []string
+	for _, column := range crd.Spec.AdditionalPrinterColumns {
+		columns = append(columns, column.Name)
+	}
+	if !reflect.DeepEqual(columns, []string{"Type", "Phase", "Age"}) {
+		t.Errorf("Expected printer columns Type, Phase and Age, but found %v", columns)
+	}
+
+	// Every field of the spec must be covered by the schema, or the API
+	// server would drop it.
+	properties := crd.Spec.Validation.OpenAPIV3Schema.Properties["spec"].Properties
+	specType := reflect.TypeOf(spec.FaultInjectorSpec{})
+	for i := 0; i < specType.NumField(); i++ {
+		name := jsonName(specType.Field(i))
+		if _, ok := properties[name]; !ok {
+			t.Errorf("Expected the schema to cover spec.%v", name)
+		}
+	}
+
+	// The schema must be structural, or the API server rejects it.
+	validateStructural(t, "", *crd.Spec.Validation.OpenAPIV3Schema)
+
+	for _, action := range clientset.Fake.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("Found unexpected action %v %v without a ThirdPartyResource", action.GetVerb(), action.GetResource())
+		}
+	}
+
+	if err := c.createCRD(make(chan struct{})); err != nil {
+		t.Errorf("Found unexpected error when creating CRD a second time: %v", err)
+	}
+}
+
+func TestCreateCRDMigration(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	clientset.Extensions().ThirdPartyResources().Create(&extensionsobj.ThirdPartyResource{
+		ObjectMeta: v1.ObjectMeta{Name: "fault-injector.k8s.puppet.com"},
+	})
+
+	sources, err := generateTestFaultInjectors(3)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	sources[0].Spec.KillCount = 2
+	sources[0].Status.TotalFaults = 4
+	// Simulate an API server which only migrated the second FaultInjector
+	// from the ThirdPartyResource by itself.
+	migrated := ffaultinjectors.New(sources[1])
+	c.faultInjectors = &tprFaultInjectors{Client: migrated, tprObjects: sources}
+
+	clientset.PrependReactor("delete", "thirdpartyresources", func(action ktesting.Action) (bool, runtime.Object, error) {
+		list, _ := migrated.List(api.NamespaceAll)
+		if len(list.Items) != len(sources) {
+			t.Errorf("Expected the ThirdPartyResource to be deleted after restoring every FaultInjector, but found %v of %v", len(list.Items), len(sources))
+		}
+		return false, nil, nil
+	})
+
+	if err := c.createCRD(make(chan struct{})); err != nil {
+		t.Fatalf("Found unexpected error when creating CRD: %v", err)
+	}
+
+	if _, err := clientset.Extensions().ThirdPartyResources().Get("fault-injector.k8s.puppet.com"); err == nil {
+		t.Errorf("Expected the ThirdPartyResource to be deleted")
+	}
+	list, err := migrated.List(api.NamespaceAll)
+	if err != nil {
+		t.Fatalf("Found unexpected error when listing FaultInjectors: %v", err)
+	}
+	if len(list.Items) != len(sources) {
+		t.Fatalf("Expected %v FaultInjectors after migration, but found %v", len(sources), len(list.Items))
+	}
+	for _, source := range sources {
+		obj, err := migrated.Get(source.ObjectMeta.Namespace, source.ObjectMeta.Name)
+		if err != nil {
+			t.Errorf("Expected FaultInjector %v to be migrated, but found %v", source.ObjectMeta.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj.Spec, source.Spec) || !reflect.DeepEqual(obj.ObjectMeta.Labels, source.ObjectMeta.Labels) ||
+			!reflect.DeepEqual(obj.Status, source.Status) {
+			t.Errorf("Expected FaultInjector %v to be migrated unchanged, but found %v", source.ObjectMeta.Name, obj)
+		}
+	}
+	if obj, _ := migrated.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name); obj != nil && obj.Status.TotalFaults != 4 {
+		t.Errorf("Expected the status of FaultInjector %v to be migrated with 4 faults, but found %v", sources[0].ObjectMeta.Name, obj.Status.TotalFaults)
+	}
+}
+
+// tprFaultInjectors lists the FaultInjectors stored by a ThirdPartyResource,
+// while the CustomResourceDefinition serves the rest.
+type tprFaultInjectors struct {
+	*ffaultinjectors.Client
+	tprObjects []*spec.FaultInjector
+}
+
+func (c *tprFaultInjectors) List(namespace string) (*spec.FaultInjectorList, error) {
+	return &spec.FaultInjectorList{Items: c.tprObjects}, nil
+}
+
+// validateStructural checks that every property of a schema has a type.
+func validateStructural(t *testing.T, path string, schema apiextensions.JSONSchemaProps) {
+	if schema.Type == "" && !schema.XIntOrString {
+		t.Errorf("Expected the schema of %v to have a type", path)
+	}
+	for name, property := range schema.Properties {
+		validateStructural(t, path+"."+name, property)
+	}
+	if schema.Items != nil {
+		validateStructural(t, path+"[]", *schema.Items)
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	for i := range tag {
+		if tag[i] == ',' {
+			return tag[:i]
+		}
+	}
+	return tag
+}
@@ -1,52 +1,60 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/puppetlabs/fault-injector-controller/pkg/schedule"
 	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
 	"github.com/puppetlabs/fault-injector-controller/version"
 
 	"k8s.io/client-go/1.5/pkg/api/v1"
 	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/fields"
+	"k8s.io/client-go/1.5/pkg/labels"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
 )
 
+// downstreamNamePrefix is prepended to the name of a FaultInjector to name
+// its Deployment.
+const downstreamNamePrefix = "faultinjector-"
+
+// downstreamMetricsPort is the port on which injectors serve metrics.
+const downstreamMetricsPort int32 = 8080
+
+// downstreamReplicas is the number of injectors run for each FaultInjector.
+const downstreamReplicas int32 = 1
+
 func generateDownstreamObject(obj *spec.FaultInjector) (*extensionsobj.Deployment, error) {
 	containers, err := generateDownstreamContainers(obj)
 	if err != nil {
 		return nil, err
 	}
 	labels := generateDownstreamLabels(obj)
+	replicas := downstreamReplicas
 
 	deploymentObj := &extensionsobj.Deployment{
 		ObjectMeta: v1.ObjectMeta{
-			Name:      formatDownstreamName(obj),
-			Namespace: obj.ObjectMeta.Namespace,
-			Labels:    map[string]string{"generatedBy": "FaultInjector"},
+			Name:            formatDownstreamName(obj),
+			Namespace:       obj.ObjectMeta.Namespace,
+			Labels:          map[string]string{spec.GeneratedByLabel: spec.GeneratedByValue},
+			Annotations:     map[string]string{spec.SpecHashAnnotation: specHash(obj)},
+			OwnerReferences: generateDownstreamOwnerReferences(obj),
 		},
 		Spec: extensionsobj.DeploymentSpec{
+			Replicas: &replicas,
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: v1.ObjectMeta{
 					Labels: labels,
 				},
 				Spec: v1.PodSpec{
 					Containers: containers,
-					Volumes: []v1.Volume{
-						v1.Volume{
-							Name: "podinfo",
-							VolumeSource: v1.VolumeSource{
-								DownwardAPI: &v1.DownwardAPIVolumeSource{
-									Items: []v1.DownwardAPIVolumeFile{
-										v1.DownwardAPIVolumeFile{
-											Path: "namespace",
-											FieldRef: &v1.ObjectFieldSelector{
-												FieldPath: "metadata.namespace",
-											},
-										},
-									},
-								},
-							},
-						},
-					},
+					Volumes:    generateDownstreamVolumes(),
 				},
 			},
 		},
@@ -65,23 +73,236 @@ func updateDownstreamObject(downstreamObj *extensionsobj.Deployment, newObj *spe
 		return err
 	}
 	labels := generateDownstreamLabels(newObj)
+	replicas := downstreamReplicas
+	deploymentLabels := make(map[string]string)
+	for k, v := range downstreamObj.ObjectMeta.Labels {
+		deploymentLabels[k] = v
+	}
+	deploymentLabels[spec.GeneratedByLabel] = spec.GeneratedByValue
+	downstreamObj.ObjectMeta.Labels = deploymentLabels
+	deploymentAnnotations := make(map[string]string)
+	for k, v := range downstreamObj.ObjectMeta.Annotations {
+		deploymentAnnotations[k] = v
+	}
+	deploymentAnnotations[spec.SpecHashAnnotation] = specHash(newObj)
+	downstreamObj.ObjectMeta.Annotations = deploymentAnnotations
+	if ownerReferences := generateDownstreamOwnerReferences(newObj); ownerReferences != nil {
+		downstreamObj.ObjectMeta.OwnerReferences = ownerReferences
+	}
+	downstreamObj.Spec.Replicas = &replicas
 	downstreamObj.Spec.Template.ObjectMeta.Labels = labels
 	downstreamObj.Spec.Template.Spec.Containers = containers
+	downstreamObj.Spec.Template.Spec.Volumes = generateDownstreamVolumes()
 	return nil
 }
 
+// downstreamDrift returns the names of the fields managed by the controller
+// in which a live Deployment differs from the desired Deployment. Fields
+// defaulted by the API server are ignored.
+func downstreamDrift(live, desired *extensionsobj.Deployment) []string {
+	var drift []string
+	if live.ObjectMeta.Labels[spec.GeneratedByLabel] != spec.GeneratedByValue ||
+		!reflect.DeepEqual(live.Spec.Template.ObjectMeta.Labels, desired.Spec.Template.ObjectMeta.Labels) {
+		drift = append(drift, "labels")
+	}
+	if live.ObjectMeta.Annotations[spec.SpecHashAnnotation] != desired.ObjectMeta.Annotations[spec.SpecHashAnnotation] {
+		drift = append(drift, "annotations")
+	}
+	if !ownerReferencesEqual(live.ObjectMeta.OwnerReferences, desired.ObjectMeta.OwnerReferences) {
+		drift = append(drift, "ownerReferences")
+	}
+	if live.Spec.Replicas == nil || *live.Spec.Replicas != *desired.Spec.Replicas {
+		drift = append(drift, "replicas")
+	}
+	liveContainers := live.Spec.Template.Spec.Containers
+	desiredContainers := desired.Spec.Template.Spec.Containers
+	if len(liveContainers) != len(desiredContainers) {
+		drift = append(drift, "containers")
+	} else {
+		var image, args, mounts bool
+		for i := range desiredContainers {
+			if liveContainers[i].Name != desiredContainers[i].Name {
+				image, args, mounts = true, true, true
+				break
+			}
+			image = image || liveContainers[i].Image != desiredContainers[i].Image
+			args = args || !stringsEqual(liveContainers[i].Args, desiredContainers[i].Args)
+			mounts = mounts || !volumeMountsEqual(liveContainers[i].VolumeMounts, desiredContainers[i].VolumeMounts)
+		}
+		if image {
+			drift = append(drift, "image")
+		}
+		if args {
+			drift = append(drift, "args")
+		}
+		if mounts {
+			drift = append(drift, "volumeMounts")
+		}
+	}
+	if !volumesEqual(live.Spec.Template.Spec.Volumes, desired.Spec.Template.Spec.Volumes) {
+		drift = append(drift, "volumes")
+	}
+	return drift
+}
+
+// ownerReferencesEqual returns whether a live Deployment is owned by the
+// FaultInjector owning the desired Deployment, if it has one.
+func ownerReferencesEqual(live, desired []v1.OwnerReference) bool {
+	if len(desired) == 0 {
+		return true
+	}
+	return len(live) == len(desired) && live[0].UID == desired[0].UID &&
+		live[0].Controller != nil && *live[0].Controller
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func volumeMountsEqual(a, b []v1.VolumeMount) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].MountPath != b[i].MountPath || a[i].ReadOnly != b[i].ReadOnly {
+			return false
+		}
+	}
+	return true
+}
+
+// volumesEqual compares the downward API volumes generated by the controller.
+func volumesEqual(a, b []v1.Volume) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || (a[i].DownwardAPI == nil) != (b[i].DownwardAPI == nil) {
+			return false
+		}
+		if a[i].DownwardAPI == nil {
+			continue
+		}
+		aItems, bItems := a[i].DownwardAPI.Items, b[i].DownwardAPI.Items
+		if len(aItems) != len(bItems) {
+			return false
+		}
+		for j := range aItems {
+			if aItems[j].Path != bItems[j].Path || (aItems[j].FieldRef == nil) != (bItems[j].FieldRef == nil) {
+				return false
+			}
+			if aItems[j].FieldRef != nil && aItems[j].FieldRef.FieldPath != bItems[j].FieldRef.FieldPath {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// generateDownstreamOwnerReferences makes a FaultInjector the controlling
+// owner of its Deployment, so that the Deployment is garbage collected with
+// the FaultInjector even if the controller misses its deletion. It returns nil
+// if the FaultInjector has not been stored by the API server yet.
+func generateDownstreamOwnerReferences(obj *spec.FaultInjector) []v1.OwnerReference {
+	if obj.ObjectMeta.UID == "" {
+		return nil
+	}
+	controller := true
+	return []v1.OwnerReference{
+		{
+			APIVersion: spec.GroupName + "/" + version.ResourceAPIVersion,
+			Kind:       spec.Kind,
+			Name:       obj.ObjectMeta.Name,
+			UID:        obj.ObjectMeta.UID,
+			Controller: &controller,
+		},
+	}
+}
+
+func generateDownstreamVolumes() []v1.Volume {
+	return []v1.Volume{
+		v1.Volume{
+			Name: "podinfo",
+			VolumeSource: v1.VolumeSource{
+				DownwardAPI: &v1.DownwardAPIVolumeSource{
+					Items: []v1.DownwardAPIVolumeFile{
+						v1.DownwardAPIVolumeFile{
+							Path: "namespace",
+							FieldRef: &v1.ObjectFieldSelector{
+								FieldPath: "metadata.namespace",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// specHash returns a hash of the fields of a FaultInjector from which its
+// Deployment is generated.
+func specHash(obj *spec.FaultInjector) string {
+	b, _ := json.Marshal(struct {
+		Labels map[string]string      `json:"labels,omitempty"`
+		Spec   spec.FaultInjectorSpec `json:"spec"`
+	}{obj.ObjectMeta.Labels, obj.Spec})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// removeString returns a copy of a list of strings without the given string.
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseDownstreamName returns the name of the FaultInjector owning a
+// Deployment, or false if the Deployment name was not generated by
+// formatDownstreamName.
+func parseDownstreamName(name string) (string, bool) {
+	if !strings.HasPrefix(name, downstreamNamePrefix) || len(name) == len(downstreamNamePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, downstreamNamePrefix), true
+}
+
 func formatDownstreamName(obj *spec.FaultInjector) string {
-	return fmt.Sprintf("faultinjector-%v", obj.ObjectMeta.Name)
+	return downstreamNamePrefix + obj.ObjectMeta.Name
 }
 
 func generateDownstreamContainers(obj *spec.FaultInjector) ([]v1.Container, error) {
 	var containers []v1.Container
 	switch obj.Spec.Type {
 	case "PodKiller":
+		args, err := generatePodKillerArgs(obj)
+		if err != nil {
+			return nil, err
+		}
 		containers = append(containers, v1.Container{
 			Name:  "fault-injector-podkiller",
 			Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
-			Args:  []string{"-namespace-file", "/etc/namespace"},
+			Args:  args,
+			Ports: []v1.ContainerPort{
+				v1.ContainerPort{
+					Name:          "metrics",
+					ContainerPort: downstreamMetricsPort,
+				},
+			},
+			LivenessProbe:  generateDownstreamProbe("/healthz"),
+			ReadinessProbe: generateDownstreamProbe("/readyz"),
 			VolumeMounts: []v1.VolumeMount{
 				v1.VolumeMount{
 					Name:      "podinfo",
@@ -96,11 +317,116 @@ func generateDownstreamContainers(obj *spec.FaultInjector) ([]v1.Container, erro
 	return containers, nil
 }
 
+// generateDownstreamProbe returns a probe of the given health check path on
+// the metrics port of an injector.
+func generateDownstreamProbe(path string) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			HTTPGet: &v1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString("metrics"),
+			},
+		},
+	}
+}
+
+func generatePodKillerArgs(obj *spec.FaultInjector) ([]string, error) {
+	args := []string{"-namespace-file", "/etc/namespace", "-name", obj.ObjectMeta.Name}
+	if obj.Spec.Selector.LabelSelector != "" {
+		if _, err := labels.Parse(obj.Spec.Selector.LabelSelector); err != nil {
+			return nil, fmt.Errorf("Invalid value %v for spec.selector.labelSelector on the FaultInjector: %v", obj.Spec.Selector.LabelSelector, err)
+		}
+		args = append(args, "-label-selector", obj.Spec.Selector.LabelSelector)
+	}
+	if obj.Spec.Selector.FieldSelector != "" {
+		if _, err := fields.ParseSelector(obj.Spec.Selector.FieldSelector); err != nil {
+			return nil, fmt.Errorf("Invalid value %v for spec.selector.fieldSelector on the FaultInjector: %v", obj.Spec.Selector.FieldSelector, err)
+		}
+		args = append(args, "-field-selector", obj.Spec.Selector.FieldSelector)
+	}
+	if obj.Spec.Interval.Duration < 0 {
+		return nil, fmt.Errorf("Invalid value %v for spec.interval on the FaultInjector: must not be negative", obj.Spec.Interval.Duration)
+	} else if obj.Spec.Interval.Duration > 0 {
+		args = append(args, "-interval", obj.Spec.Interval.Duration.String())
+	}
+	if obj.Spec.Jitter.Duration < 0 {
+		return nil, fmt.Errorf("Invalid value %v for spec.jitter on the FaultInjector: must not be negative", obj.Spec.Jitter.Duration)
+	} else if obj.Spec.Jitter.Duration > 0 {
+		args = append(args, "-jitter", obj.Spec.Jitter.Duration.String())
+	}
+	if obj.Spec.KillCount != 0 && obj.Spec.KillPercent != 0 {
+		return nil, fmt.Errorf("Only one of spec.killCount and spec.killPercent may be set on the FaultInjector")
+	}
+	if obj.Spec.KillCount < 0 {
+		return nil, fmt.Errorf("Invalid value %v for spec.killCount on the FaultInjector: must not be negative", obj.Spec.KillCount)
+	} else if obj.Spec.KillCount > 0 {
+		args = append(args, "-kill-count", strconv.Itoa(int(obj.Spec.KillCount)))
+	}
+	if obj.Spec.KillPercent < 0 || obj.Spec.KillPercent > 100 {
+		return nil, fmt.Errorf("Invalid value %v for spec.killPercent on the FaultInjector: must be between 0 and 100", obj.Spec.KillPercent)
+	} else if obj.Spec.KillPercent > 0 {
+		args = append(args, "-kill-percent", strconv.Itoa(int(obj.Spec.KillPercent)))
+	}
+	if obj.Spec.OptIn {
+		args = append(args, "-opt-in")
+	}
+	if !obj.Spec.Method.IsValid() {
+		return nil, fmt.Errorf("Unsupported value %v for spec.method on the FaultInjector", obj.Spec.Method)
+	} else if obj.Spec.Method != "" {
+		args = append(args, "-method", string(obj.Spec.Method))
+	}
+	if obj.Spec.GracePeriodSeconds != nil {
+		if *obj.Spec.GracePeriodSeconds < 0 {
+			return nil, fmt.Errorf("Invalid value %v for spec.gracePeriodSeconds on the FaultInjector: must not be negative", *obj.Spec.GracePeriodSeconds)
+		}
+		args = append(args, "-grace-period", strconv.FormatInt(*obj.Spec.GracePeriodSeconds, 10))
+	}
+	if obj.Spec.MinAvailable != nil {
+		if !spec.IsValidMinAvailable(*obj.Spec.MinAvailable) {
+			return nil, fmt.Errorf("Invalid value %v for spec.minAvailable on the FaultInjector: must be a non-negative number or a percentage between 0%% and 100%%", obj.Spec.MinAvailable.String())
+		}
+		args = append(args, "-min-available", obj.Spec.MinAvailable.String())
+	}
+	if obj.Spec.DryRun {
+		args = append(args, "-dry-run")
+	}
+	if obj.Spec.Schedule != nil {
+		if _, err := schedule.New(*obj.Spec.Schedule); err != nil {
+			return nil, fmt.Errorf("Invalid value for spec.schedule on the FaultInjector: %v", err)
+		}
+		if obj.Spec.Schedule.TimeZone != "" {
+			args = append(args, "-schedule-time-zone", obj.Spec.Schedule.TimeZone)
+		}
+		if obj.Spec.Schedule.Cron != "" {
+			args = append(args, "-schedule-cron", obj.Spec.Schedule.Cron)
+		}
+		for _, w := range obj.Spec.Schedule.Windows {
+			args = append(args, "-schedule-window", schedule.FormatWindow(w))
+		}
+	}
+	return args, nil
+}
+
+// setBudgetNamespace tells the injectors of a Deployment where to find the
+// budget ConfigMap. No budget is enforced if namespace is empty.
+func setBudgetNamespace(deployment *extensionsobj.Deployment, namespace string) {
+	if namespace == "" {
+		return
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	for i := range containers {
+		if containers[i].Name == "fault-injector-podkiller" {
+			containers[i].Args = append(containers[i].Args, "-budget-namespace", namespace)
+		}
+	}
+}
+
 func generateDownstreamLabels(obj *spec.FaultInjector) map[string]string {
 	labels := make(map[string]string)
 	for k, v := range obj.ObjectMeta.Labels {
 		labels[k] = v
 	}
 	labels["faultinjector-type"] = string(obj.Spec.Type)
+	labels[spec.GeneratedByLabel] = spec.GeneratedByValue
 	return labels
 }
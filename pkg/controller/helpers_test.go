@@ -5,12 +5,16 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
 	"github.com/puppetlabs/fault-injector-controller/version"
 
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
 	"k8s.io/client-go/1.5/pkg/api/v1"
 	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/labels"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
 )
 
 type resourceContainerMap struct {
@@ -84,19 +88,25 @@ func TestGenerateDownstreamLabels(t *testing.T) {
 			if len(labels) == 0 {
 				t.Error("Expected at least one label, found zero")
 			} else if test.ObjectMeta.Labels == nil {
-				if len(labels) != 1 {
-					t.Errorf("Expected exactly one label, found %v", len(labels))
+				if len(labels) != 2 {
+					t.Errorf("Expected exactly two labels, found %v", len(labels))
 				} else {
 					if labels["faultinjector-type"] != string(test.Spec.Type) {
 						t.Errorf("Expected label 'faultinjector-type' to have value '%v', but got '%v'", test.Spec.Type, labels["faultinjector-type"])
 					}
+					if labels["generatedBy"] != "FaultInjector" {
+						t.Errorf("Expected label 'generatedBy' to have value 'FaultInjector', but got '%v'", labels["generatedBy"])
+					}
 				}
-			} else if len(labels) != len(test.ObjectMeta.Labels)+1 {
-				t.Errorf("Expected %v labels, but got %v", len(test.ObjectMeta.Labels), len(labels))
+			} else if len(labels) != len(test.ObjectMeta.Labels)+2 {
+				t.Errorf("Expected %v labels, but got %v", len(test.ObjectMeta.Labels)+2, len(labels))
 			} else {
 				if labels["faultinjector-type"] != string(test.Spec.Type) {
 					t.Errorf("Expected label 'faultinjector-type' to have value '%v', but got '%v'", test.Spec.Type, labels["faultinjector-type"])
 				}
+				if labels["generatedBy"] != "FaultInjector" {
+					t.Errorf("Expected label 'generatedBy' to have value 'FaultInjector', but got '%v'", labels["generatedBy"])
+				}
 				for label, value := range test.ObjectMeta.Labels {
 					if labels[label] != value {
 						t.Errorf("Expected label '%v' to have value '%v', but got '%v'", label, value, labels[label])
@@ -112,6 +122,7 @@ func TestGenerateDownstreamObject(t *testing.T) {
 	for name, test := range tests {
 		var expectedObj *extensionsobj.Deployment
 		containers, expectedErr := generateDownstreamContainers(test)
+		replicas := int32(1)
 		if expectedErr != nil {
 			expectedObj = nil
 		} else {
@@ -120,8 +131,12 @@ func TestGenerateDownstreamObject(t *testing.T) {
 					Name:      formatDownstreamName(test),
 					Namespace: test.ObjectMeta.Namespace,
 					Labels:    map[string]string{"generatedBy": "FaultInjector"},
+					Annotations: map[string]string{
+						"faultinjector.k8s.puppet.com/spec-hash": specHash(test),
+					},
 				},
 				Spec: extensionsobj.DeploymentSpec{
+					Replicas: &replicas,
 					Template: v1.PodTemplateSpec{
 						ObjectMeta: v1.ObjectMeta{
 							Labels: generateDownstreamLabels(test),
@@ -168,6 +183,28 @@ func TestGenerateDownstreamObject(t *testing.T) {
 	}
 }
 
+func TestSetBudgetNamespace(t *testing.T) {
+	obj := &spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "lanthanides"},
+		Spec:       spec.FaultInjectorSpec{Type: "PodKiller"},
+	}
+	deployment, err := generateDownstreamObject(obj)
+	if err != nil {
+		t.Fatalf("Found unexpected error when generating deployment: %v", err)
+	}
+	args := deployment.Spec.Template.Spec.Containers[0].Args
+
+	setBudgetNamespace(deployment, "")
+	if !stringsEqual(deployment.Spec.Template.Spec.Containers[0].Args, args) {
+		t.Errorf("Expected no budget arguments, but found %v", deployment.Spec.Template.Spec.Containers[0].Args)
+	}
+	setBudgetNamespace(deployment, "chaos")
+	expected := append(append([]string{}, args...), "-budget-namespace", "chaos")
+	if !stringsEqual(deployment.Spec.Template.Spec.Containers[0].Args, expected) {
+		t.Errorf("Expected arguments %v, but found %v", expected, deployment.Spec.Template.Spec.Containers[0].Args)
+	}
+}
+
 func TestUpdateDownstreamObject(t *testing.T) {
 	tests := getUpdateDownstreamObjectTests()
 	for name, test := range tests {
@@ -207,6 +244,81 @@ func TestUpdateDownstreamObject(t *testing.T) {
 	}
 }
 
+func TestDownstreamDrift(t *testing.T) {
+	obj := &spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "helium",
+			Namespace: v1.NamespaceDefault,
+			Labels:    map[string]string{"group": "noble"},
+			UID:       "2b4e8e3c-5b1c-4d43-9c55-1a7c9f0e2d11",
+		},
+		Spec: spec.FaultInjectorSpec{
+			Type: "PodKiller",
+		},
+	}
+	tests := map[string]struct {
+		change   func(*extensionsobj.Deployment)
+		expected []string
+	}{
+		"NoChange": {func(d *extensionsobj.Deployment) {}, nil},
+		"Defaulted": {func(d *extensionsobj.Deployment) {
+			d.Spec.Template.Spec.Containers[0].ImagePullPolicy = v1.PullIfNotPresent
+			d.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+			d.Spec.Template.Spec.Volumes[0].DownwardAPI.Items[0].FieldRef.APIVersion = "v1"
+			d.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyAlways
+		}, nil},
+		"Labels": {func(d *extensionsobj.Deployment) {
+			d.Spec.Template.ObjectMeta.Labels["group"] = "alkali"
+		}, []string{"labels"}},
+		"GeneratedByLabel": {func(d *extensionsobj.Deployment) {
+			d.ObjectMeta.Labels = nil
+		}, []string{"labels"}},
+		"SpecHash": {func(d *extensionsobj.Deployment) {
+			d.ObjectMeta.Annotations[spec.SpecHashAnnotation] = "stale"
+		}, []string{"annotations"}},
+		"OwnerReferences": {func(d *extensionsobj.Deployment) {
+			d.ObjectMeta.OwnerReferences = nil
+		}, []string{"ownerReferences"}},
+		"Replicas": {func(d *extensionsobj.Deployment) {
+			replicas := int32(0)
+			d.Spec.Replicas = &replicas
+		}, []string{"replicas"}},
+		"ImageAndArgs": {func(d *extensionsobj.Deployment) {
+			d.Spec.Template.Spec.Containers[0].Image = "busybox"
+			d.Spec.Template.Spec.Containers[0].Args = append(d.Spec.Template.Spec.Containers[0].Args, "-dry-run")
+		}, []string{"image", "args"}},
+		"Volumes": {func(d *extensionsobj.Deployment) {
+			d.Spec.Template.Spec.Volumes = nil
+			d.Spec.Template.Spec.Containers[0].VolumeMounts = nil
+		}, []string{"volumeMounts", "volumes"}},
+		"Containers": {func(d *extensionsobj.Deployment) {
+			d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, v1.Container{Name: "sidecar"})
+		}, []string{"containers"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			desired, err := generateDownstreamObject(obj)
+			if err != nil {
+				t.Fatalf("Found unexpected error when generating desired object: %v", err)
+			}
+			live, err := generateDownstreamObject(obj)
+			if err != nil {
+				t.Fatalf("Found unexpected error when generating live object: %v", err)
+			}
+			test.change(live)
+			if drift := downstreamDrift(live, desired); !reflect.DeepEqual(drift, test.expected) {
+				t.Errorf("Expected drift in %v, but found %v", test.expected, drift)
+			}
+			if err := updateDownstreamObject(live, obj); err != nil {
+				t.Fatalf("Found unexpected error when updating live object: %v", err)
+			}
+			if drift := downstreamDrift(live, desired); drift != nil {
+				t.Errorf("Expected no drift after updating, but found %v", drift)
+			}
+		})
+	}
+}
+
 func getGenerateDownstreamContainersTests() map[string]resourceContainerMap {
 	tests := make(map[string]resourceContainerMap)
 	tests["PodKiller"] = resourceContainerMap{
@@ -223,7 +335,417 @@ func getGenerateDownstreamContainersTests() map[string]resourceContainerMap {
 			v1.Container{
 				Name:  "fault-injector-podkiller",
 				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
-				Args:  []string{"-namespace-file", "/etc/namespace"},
+				Args:  []string{"-namespace-file", "/etc/namespace", "-name", "hydrogen"},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-Selector"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "lithium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type: "PodKiller",
+				Selector: spec.FaultInjectorSelector{
+					LabelSelector: "app=checkout,tier=frontend",
+					FieldSelector: "status.phase=Running",
+				},
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "lithium",
+					"-label-selector", "app=checkout,tier=frontend",
+					"-field-selector", "status.phase=Running",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-InvalidSelector"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "beryllium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type: "PodKiller",
+				Selector: spec.FaultInjectorSelector{
+					LabelSelector: "app in checkout",
+				},
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Invalid value app in checkout for spec.selector.labelSelector on the FaultInjector: %v", labelParseError("app in checkout")),
+	}
+	tests["PodKiller-IntervalJitter"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "boron",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:     "PodKiller",
+				Interval: unversioned.Duration{Duration: 5 * time.Minute},
+				Jitter:   unversioned.Duration{Duration: 90 * time.Second},
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "boron",
+					"-interval", "5m0s",
+					"-jitter", "1m30s",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-NegativeJitter"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "carbon",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:   "PodKiller",
+				Jitter: unversioned.Duration{Duration: -time.Second},
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Invalid value -1s for spec.jitter on the FaultInjector: must not be negative"),
+	}
+	tests["PodKiller-KillPercent"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "nitrogen",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:        "PodKiller",
+				KillPercent: 30,
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "nitrogen",
+					"-kill-percent", "30",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-KillCountAndPercent"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "oxygen",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:        "PodKiller",
+				KillCount:   3,
+				KillPercent: 30,
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Only one of spec.killCount and spec.killPercent may be set on the FaultInjector"),
+	}
+	tests["PodKiller-Evict"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "fluorine",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:   "PodKiller",
+				Method: spec.KillMethodEvict,
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "fluorine",
+					"-method", "evict",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-InvalidMethod"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "neon",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:   "PodKiller",
+				Method: "explode",
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Unsupported value explode for spec.method on the FaultInjector"),
+	}
+	tests["PodKiller-ZeroGracePeriod"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "sodium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:               "PodKiller",
+				GracePeriodSeconds: new(int64),
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "sodium",
+					"-grace-period", "0",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-DryRun"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "magnesium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:   "PodKiller",
+				DryRun: true,
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "magnesium",
+					"-dry-run",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	minAvailable, invalidMinAvailable := intstr.FromString("50%"), intstr.FromString("half")
+	tests["PodKiller-MinAvailable"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "sodium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:         "PodKiller",
+				MinAvailable: &minAvailable,
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "sodium",
+					"-min-available", "50%",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
+				VolumeMounts: []v1.VolumeMount{
+					v1.VolumeMount{
+						Name:      "podinfo",
+						MountPath: "/etc",
+						ReadOnly:  false,
+					},
+				},
+			},
+		},
+		ErrorValue: nil,
+	}
+	tests["PodKiller-InvalidMinAvailable"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "potassium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:         "PodKiller",
+				MinAvailable: &invalidMinAvailable,
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Invalid value half for spec.minAvailable on the FaultInjector: must be a non-negative number or a percentage between 0%% and 100%%"),
+	}
+	tests["PodKiller-Schedule"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "aluminium",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type: "PodKiller",
+				Schedule: &spec.FaultInjectorSchedule{
+					TimeZone: "Europe/London",
+					Cron:     "* 10-15 * * Mon-Fri",
+					Windows: []spec.ScheduleWindow{
+						{Days: []string{"Mon-Fri"}, Start: "10:00", End: "16:00"},
+						{Start: "22:00", End: "02:00"},
+					},
+				},
+			},
+		},
+		Containers: []v1.Container{
+			v1.Container{
+				Name:  "fault-injector-podkiller",
+				Image: fmt.Sprintf("%v/fault-injector-podkiller:%v", imagePrefix, version.Version),
+				Args: []string{
+					"-namespace-file", "/etc/namespace",
+					"-name", "aluminium",
+					"-schedule-time-zone", "Europe/London",
+					"-schedule-cron", "* 10-15 * * Mon-Fri",
+					"-schedule-window", "Mon-Fri 10:00-16:00",
+					"-schedule-window", "22:00-02:00",
+				},
+				Ports: []v1.ContainerPort{
+					v1.ContainerPort{
+						Name:          "metrics",
+						ContainerPort: downstreamMetricsPort,
+					},
+				},
+				LivenessProbe:  generateDownstreamProbe("/healthz"),
+				ReadinessProbe: generateDownstreamProbe("/readyz"),
 				VolumeMounts: []v1.VolumeMount{
 					v1.VolumeMount{
 						Name:      "podinfo",
@@ -235,6 +757,20 @@ func getGenerateDownstreamContainersTests() map[string]resourceContainerMap {
 		},
 		ErrorValue: nil,
 	}
+	tests["PodKiller-InvalidSchedule"] = resourceContainerMap{
+		FaultInjector: &spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "silicon",
+				Namespace: v1.NamespaceDefault,
+			},
+			Spec: spec.FaultInjectorSpec{
+				Type:     "PodKiller",
+				Schedule: &spec.FaultInjectorSchedule{},
+			},
+		},
+		Containers: nil,
+		ErrorValue: fmt.Errorf("Invalid value for spec.schedule on the FaultInjector: A schedule must have a cron expression or at least one window"),
+	}
 	tests["NetworkLatency"] = resourceContainerMap{
 		FaultInjector: &spec.FaultInjector{
 			ObjectMeta: v1.ObjectMeta{
@@ -251,6 +787,11 @@ func getGenerateDownstreamContainersTests() map[string]resourceContainerMap {
 	return tests
 }
 
+func labelParseError(selector string) error {
+	_, err := labels.Parse(selector)
+	return err
+}
+
 func getGenerateDownstreamLabelsTests() map[string]*spec.FaultInjector {
 	tests := make(map[string]*spec.FaultInjector)
 	tests["NilLabels"] = &spec.FaultInjector{
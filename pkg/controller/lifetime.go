@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// lifetime is the period in which a FaultInjector injects faults. A zero
+// start or end leaves the period open on that side.
+type lifetime struct {
+	start, end time.Time
+}
+
+// notStarted returns whether the lifetime starts after t.
+func (l lifetime) notStarted(t time.Time) bool {
+	return !l.start.IsZero() && t.Before(l.start)
+}
+
+// completed returns whether the lifetime ended at or before t.
+func (l lifetime) completed(t time.Time) bool {
+	return !l.end.IsZero() && !t.Before(l.end)
+}
+
+// faultInjectorLifetime returns the lifetime of a FaultInjector given by its
+// start time, and by either its duration or its end time.
+func faultInjectorLifetime(obj *spec.FaultInjector) (lifetime, error) {
+	var l lifetime
+	if obj.Spec.StartTime != nil {
+		l.start = obj.Spec.StartTime.Time
+	}
+	if obj.Spec.Duration.Duration < 0 {
+		return l, fmt.Errorf("Invalid value %v for spec.duration on the FaultInjector: must not be negative", obj.Spec.Duration.Duration)
+	}
+	if ttl := obj.Spec.TTLSecondsAfterCompletion; ttl != nil && *ttl < 0 {
+		return l, fmt.Errorf("Invalid value %v for spec.ttlSecondsAfterCompletion on the FaultInjector: must not be negative", *ttl)
+	}
+	switch {
+	case obj.Spec.EndTime != nil && obj.Spec.Duration.Duration > 0:
+		return l, fmt.Errorf("Only one of spec.duration and spec.endTime may be set on the FaultInjector")
+	case obj.Spec.EndTime != nil:
+		l.end = obj.Spec.EndTime.Time
+	case obj.Spec.Duration.Duration > 0:
+		start := l.start
+		if start.IsZero() {
+			start = obj.ObjectMeta.CreationTimestamp.Time
+		}
+		if !start.IsZero() {
+			l.end = start.Add(obj.Spec.Duration.Duration)
+		}
+	}
+	if !l.start.IsZero() && !l.end.IsZero() && !l.end.After(l.start) {
+		return l, fmt.Errorf("Invalid value %v for spec.endTime on the FaultInjector: must be after spec.startTime", l.end.Format(time.RFC3339))
+	}
+	return l, nil
+}
+
+// syncFaultInjector runs the injectors of a FaultInjector during its
+// lifetime. No Deployment is created before the FaultInjector starts, and its
+// Deployment is deleted once it completes, followed by the FaultInjector
+// itself once its TTL expires. The FaultInjector is requeued for whichever of
+// these comes next.
+func (c *FaultInjectorController) syncFaultInjector(key string, obj *spec.FaultInjector) error {
+	l, err := faultInjectorLifetime(obj)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch {
+	case l.notStarted(now):
+		c.requeueAt(key, l.start, now)
+		return c.removeInjectors(obj)
+	case l.completed(now):
+		if obj.Status.CompletionTime == nil {
+			fmt.Printf("FaultInjector %v completed, removing its injectors\n", key)
+			c.recorder.Eventf(obj, v1.EventTypeNormal, "Completed", "Stopped injecting faults after %v faults", obj.Status.TotalFaults)
+		}
+		if err := c.removeInjectors(obj); err != nil {
+			return err
+		}
+		return c.expire(key, obj, l.end, now)
+	}
+	if !l.end.IsZero() {
+		c.requeueAt(key, l.end, now)
+	}
+	return c.addFaultInjector(obj)
+}
+
+// removeInjectors deletes the Deployment of a FaultInjector, if it exists.
+func (c *FaultInjectorController) removeInjectors(obj *spec.FaultInjector) error {
+	if err := c.deleteFaultInjector(obj); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// expire deletes a FaultInjector which completed at end once its TTL has
+// passed, or requeues it until then.
+func (c *FaultInjectorController) expire(key string, obj *spec.FaultInjector, end, now time.Time) error {
+	if obj.Spec.TTLSecondsAfterCompletion == nil {
+		return nil
+	}
+	expiry := end.Add(time.Duration(*obj.Spec.TTLSecondsAfterCompletion) * time.Second)
+	if now.Before(expiry) {
+		c.requeueAt(key, expiry, now)
+		return nil
+	}
+	fmt.Printf("Deleting FaultInjector %v, %v seconds after it completed\n", key, *obj.Spec.TTLSecondsAfterCompletion)
+	err := c.faultInjectors.Delete(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// requeueAt queues a FaultInjector to be reconciled again at t, unless the
+// informer resyncs it before then.
+func (c *FaultInjectorController) requeueAt(key string, t, now time.Time) {
+	delay := t.Sub(now)
+	if c.resyncPeriod > 0 && delay > c.resyncPeriod {
+		return
+	}
+	c.queue.AddAfter(key, delay)
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/tools/record"
+)
+
+func TestFaultInjectorLifetime(t *testing.T) {
+	created := time.Date(2018, 1, 8, 9, 0, 0, 0, time.UTC)
+	start := unversioned.NewTime(created.Add(time.Hour))
+	end := unversioned.NewTime(created.Add(3 * time.Hour))
+	negative := int32(-1)
+	tests := map[string]struct {
+		spec     spec.FaultInjectorSpec
+		expected lifetime
+		valid    bool
+	}{
+		"Unbounded":        {spec.FaultInjectorSpec{}, lifetime{}, true},
+		"StartTime":        {spec.FaultInjectorSpec{StartTime: &start}, lifetime{start: start.Time}, true},
+		"EndTime":          {spec.FaultInjectorSpec{StartTime: &start, EndTime: &end}, lifetime{start.Time, end.Time}, true},
+		"Duration":         {spec.FaultInjectorSpec{StartTime: &start, Duration: unversioned.Duration{Duration: time.Hour}}, lifetime{start.Time, start.Add(time.Hour)}, true},
+		"DurationFromNow":  {spec.FaultInjectorSpec{Duration: unversioned.Duration{Duration: time.Hour}}, lifetime{end: created.Add(time.Hour)}, true},
+		"NegativeDuration": {spec.FaultInjectorSpec{Duration: unversioned.Duration{Duration: -time.Hour}}, lifetime{}, false},
+		"DurationAndEnd":   {spec.FaultInjectorSpec{Duration: unversioned.Duration{Duration: time.Hour}, EndTime: &end}, lifetime{}, false},
+		"EndBeforeStart":   {spec.FaultInjectorSpec{StartTime: &end, EndTime: &start}, lifetime{}, false},
+		"NegativeTTL":      {spec.FaultInjectorSpec{TTLSecondsAfterCompletion: &negative}, lifetime{}, false},
+		"EndWithoutStart":  {spec.FaultInjectorSpec{EndTime: &end}, lifetime{end: end.Time}, true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj := &spec.FaultInjector{
+				ObjectMeta: v1.ObjectMeta{CreationTimestamp: unversioned.NewTime(created)},
+				Spec:       test.spec,
+			}
+			l, err := faultInjectorLifetime(obj)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("Expected an error, but found lifetime %+v", l)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Found unexpected error: %v", err)
+			}
+			if !l.start.Equal(test.expected.start) || !l.end.Equal(test.expected.end) {
+				t.Errorf("Expected lifetime %+v, but found %+v", test.expected, l)
+			}
+		})
+	}
+}
+
+func TestReconcileLifetime(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	sources[0].Status.TotalFaults = 7
+	faultInjectors.Add(sources[0])
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	reconcile := func(t *testing.T, start, end time.Time, ttl *int32) *spec.FaultInjector {
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		startTime, endTime := unversioned.NewTime(start), unversioned.NewTime(end)
+		obj.Spec.StartTime, obj.Spec.EndTime = &startTime, &endTime
+		obj.Spec.TTLSecondsAfterCompletion = ttl
+		if obj, err = faultInjectors.Update(obj); err != nil {
+			t.Fatalf("Found unexpected error when updating FaultInjector: %v", err)
+		}
+		c.store.Update(obj)
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		obj, err = faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			return nil
+		}
+		return obj
+	}
+	now := time.Now()
+
+	obj := reconcile(t, now.Add(time.Hour), now.Add(2*time.Hour), nil)
+	if c.getDownstreamState(sources[0]) != nil {
+		t.Errorf("Expected no deployment before the FaultInjector starts")
+	}
+	if obj.Status.Phase != spec.FaultInjectorPending {
+		t.Errorf("Expected the FaultInjector to be pending, but found status %+v", obj.Status)
+	}
+	validateEvents(t, recorder)
+
+	obj = reconcile(t, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	if c.getDownstreamState(sources[0]) == nil {
+		t.Errorf("Expected a deployment once the FaultInjector started")
+	}
+	if obj.Status.CompletionTime != nil {
+		t.Errorf("Expected the FaultInjector not to be completed, but found status %+v", obj.Status)
+	}
+	validateEvents(t, recorder)
+
+	end := now.Add(-time.Minute)
+	obj = reconcile(t, now.Add(-time.Hour), end, nil)
+	if c.getDownstreamState(sources[0]) != nil {
+		t.Errorf("Expected the deployment to be deleted once the FaultInjector completed")
+	}
+	if obj.Status.Phase != spec.FaultInjectorCompleted || conditionStatus(obj.Status.Conditions, spec.FaultInjectorCompletedCondition) != v1.ConditionTrue ||
+		obj.Status.CompletionTime == nil || !obj.Status.CompletionTime.Time.Equal(unversioned.NewTime(end).Time) {
+		t.Errorf("Expected the FaultInjector to be completed at %v, but found status %+v", end, obj.Status)
+	}
+	validateEvents(t, recorder, "Normal Completed Stopped injecting faults after 7 faults")
+
+	ttl := int32(3600)
+	obj = reconcile(t, now.Add(-time.Hour), end, &ttl)
+	if obj == nil {
+		t.Fatalf("Expected the FaultInjector to be kept until its TTL expires")
+	}
+	validateEvents(t, recorder)
+
+	ttl = 0
+	if obj = reconcile(t, now.Add(-time.Hour), end, &ttl); obj != nil {
+		t.Errorf("Expected the FaultInjector to be deleted once its TTL expired, but found %+v", obj)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/1.5/tools/cache"
+)
+
+const metricsNamespace = "faultinjector"
+const metricsSubsystem = "controller"
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "reconcile_total",
+		Help:      "Number of FaultInjectors reconciled, by result.",
+	}, []string{"result"})
+	reconcileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken to reconcile a FaultInjector.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+	faultInjectorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "faultinjectors"),
+		"Number of FaultInjectors managed by the controller, by type.",
+		[]string{"type"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(reconcileTotal)
+	prometheus.MustRegister(reconcileDuration)
+}
+
+// observeReconcile records the outcome and latency of a reconciliation.
+func observeReconcile(start time.Time, err error) {
+	reconcileDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileTotal.WithLabelValues("error").Inc()
+	} else {
+		reconcileTotal.WithLabelValues("success").Inc()
+	}
+}
+
+// faultInjectorCollector counts the FaultInjectors in an informer store each
+// time metrics are collected.
+type faultInjectorCollector struct {
+	store cache.Store
+}
+
+// Describe implements prometheus.Collector.
+func (fc faultInjectorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- faultInjectorsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (fc faultInjectorCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := make(map[spec.FaultInjectorType]int)
+	for _, obj := range fc.store.List() {
+		if fi, ok := obj.(*spec.FaultInjector); ok {
+			counts[fi.Spec.Type]++
+		}
+	}
+	for faultInjectorType, count := range counts {
+		ch <- prometheus.MustNewConstMetric(faultInjectorsDesc, prometheus.GaugeValue, float64(count), string(faultInjectorType))
+	}
+}
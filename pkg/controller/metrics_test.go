@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/tools/cache"
+)
+
+func TestFaultInjectorCollector(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, name := range []string{"hydrogen", "helium"} {
+		store.Add(&spec.FaultInjector{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       spec.FaultInjectorSpec{Type: "PodKiller"},
+		})
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	faultInjectorCollector{store: store}.Collect(ch)
+	close(ch)
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Expected 1 metric, but found %v", len(metrics))
+	}
+	var m dto.Metric
+	if err := metrics[0].Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.GetGauge().GetValue() != 2 || len(m.Label) != 1 || m.Label[0].GetValue() != "PodKiller" {
+		t.Errorf("Expected 2 FaultInjectors of type PodKiller, but found %v", m.String())
+	}
+}
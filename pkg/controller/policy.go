@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/fields"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	"k8s.io/client-go/1.5/pkg/watch"
+	"k8s.io/client-go/1.5/tools/cache"
+)
+
+// policyConfigMap is the name of the ConfigMap holding the cluster-wide
+// policy which suspends every FaultInjector.
+const policyConfigMap = "fault-injector-policy"
+
+// Keys of the policy ConfigMap.
+const (
+	// policySuspendedKey suspends every FaultInjector when set to "true".
+	policySuspendedKey = "suspended"
+	// policyReasonKey explains why FaultInjectors are suspended.
+	policyReasonKey = "reason"
+	// policyBlackoutsKey holds a YAML list of blackouts.
+	policyBlackoutsKey = "blackouts"
+)
+
+// Reasons given in the Suspended condition of a FaultInjector.
+const (
+	suspendedByKillSwitch = "KillSwitch"
+	suspendedByBlackout   = "Blackout"
+	suspendedByBadPolicy  = "InvalidPolicy"
+)
+
+// policy is the parsed policy ConfigMap.
+type policy struct {
+	suspended bool
+	reason    string
+	blackouts []blackout
+	// err is set if the ConfigMap could not be parsed. FaultInjectors are
+	// suspended until it is fixed.
+	err error
+}
+
+// blackout is a period during which every FaultInjector is suspended.
+type blackout struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// suspension describes why FaultInjectors are suspended.
+type suspension struct {
+	reason  string
+	message string
+}
+
+// parsePolicy parses the policy ConfigMap. A missing ConfigMap suspends
+// nothing.
+func parsePolicy(cm *v1.ConfigMap) *policy {
+	p := &policy{}
+	if cm == nil {
+		return p
+	}
+	if value, ok := cm.Data[policySuspendedKey]; ok {
+		suspended, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			p.err = fmt.Errorf("Invalid value %q for %v: %v", value, policySuspendedKey, err)
+			return p
+		}
+		p.suspended = suspended
+	}
+	p.reason = cm.Data[policyReasonKey]
+	if value, ok := cm.Data[policyBlackoutsKey]; ok {
+		if err := yaml.Unmarshal([]byte(value), &p.blackouts); err != nil {
+			p.err = fmt.Errorf("Invalid value for %v: %v", policyBlackoutsKey, err)
+			return p
+		}
+		for _, b := range p.blackouts {
+			if b.Start.IsZero() || b.End.IsZero() || !b.End.After(b.Start) {
+				p.err = fmt.Errorf("Invalid blackout %q: start and end must be set, and end must be after start", b.Name)
+				return p
+			}
+		}
+	}
+	return p
+}
+
+// suspension returns why FaultInjectors are suspended at the given time, or
+// nil if they are not.
+func (p *policy) suspension(now time.Time) *suspension {
+	if p.err != nil {
+		return &suspension{suspendedByBadPolicy, fmt.Sprintf("Suspended until ConfigMap %v is fixed: %v", policyConfigMap, p.err)}
+	}
+	if p.suspended {
+		message := fmt.Sprintf("Suspended by ConfigMap %v", policyConfigMap)
+		if p.reason != "" {
+			message += ": " + p.reason
+		}
+		return &suspension{suspendedByKillSwitch, message}
+	}
+	for _, b := range p.blackouts {
+		if !now.Before(b.Start) && now.Before(b.End) {
+			return &suspension{suspendedByBlackout, fmt.Sprintf("Suspended by blackout %v until %v", b.Name, b.End.Format(time.RFC3339))}
+		}
+	}
+	return nil
+}
+
+// nextTransition returns the first time after now at which a blackout starts
+// or ends, or false if there is none.
+func (p *policy) nextTransition(now time.Time) (time.Time, bool) {
+	var times []time.Time
+	for _, b := range p.blackouts {
+		for _, t := range []time.Time{b.Start, b.End} {
+			if t.After(now) {
+				times = append(times, t)
+			}
+		}
+	}
+	if len(times) == 0 {
+		return time.Time{}, false
+	}
+	sort.Sort(byTime(times))
+	return times[0], true
+}
+
+type byTime []time.Time
+
+func (t byTime) Len() int           { return len(t) }
+func (t byTime) Less(i, j int) bool { return t[i].Before(t[j]) }
+func (t byTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// newPolicyInformer returns an informer watching the policy ConfigMap in the
+// given namespace.
+func (c *FaultInjectorController) newPolicyInformer(namespace string, resync time.Duration) cache.ControllerInterface {
+	selector := fields.OneTermEqualSelector("metadata.name", policyConfigMap)
+	lw := &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return c.kclient.Core().ConfigMaps(namespace).List(options)
+		},
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return c.kclient.Core().ConfigMaps(namespace).Watch(options)
+		},
+	}
+	_, controller := cache.NewInformer(lw, &v1.ConfigMap{}, resync, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.handlePolicy(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.handlePolicy(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.handlePolicy(nil)
+		},
+	})
+	return controller
+}
+
+// handlePolicy applies a new version of the policy ConfigMap to every
+// FaultInjector.
+func (c *FaultInjectorController) handlePolicy(obj interface{}) {
+	cm, _ := obj.(*v1.ConfigMap)
+	if cm != nil && cm.ObjectMeta.Name != policyConfigMap {
+		return
+	}
+	p := parsePolicy(cm)
+	if p.err != nil {
+		fmt.Fprintf(os.Stderr, "Error when parsing ConfigMap %v, suspending every FaultInjector: %v\n", policyConfigMap, p.err)
+	}
+	c.setPolicy(p)
+}
+
+// setPolicy replaces the policy, queues every FaultInjector, and schedules
+// them to be queued again when the next blackout starts or ends.
+func (c *FaultInjectorController) setPolicy(p *policy) {
+	c.policyLock.Lock()
+	defer c.policyLock.Unlock()
+	c.applyPolicyLocked(p)
+}
+
+func (c *FaultInjectorController) applyPolicyLocked(p *policy) {
+	c.policy = p
+	if c.policyTimer != nil {
+		c.policyTimer.Stop()
+		c.policyTimer = nil
+	}
+	if next, ok := p.nextTransition(time.Now()); ok {
+		c.policyTimer = time.AfterFunc(next.Sub(time.Now()), func() {
+			c.policyLock.Lock()
+			defer c.policyLock.Unlock()
+			// The policy may have been replaced since the timer was set.
+			if c.policy == p {
+				c.applyPolicyLocked(p)
+			}
+		})
+	}
+	for _, obj := range c.store.List() {
+		c.enqueue(obj)
+	}
+}
+
+// suspension returns why FaultInjectors are currently suspended, or nil if
+// they are not.
+func (c *FaultInjectorController) suspension() *suspension {
+	c.policyLock.RLock()
+	defer c.policyLock.RUnlock()
+	if c.policy == nil {
+		return nil
+	}
+	return c.policy.suspension(time.Now())
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/tools/record"
+)
+
+func TestParsePolicy(t *testing.T) {
+	now := time.Date(2017, 12, 22, 12, 0, 0, 0, time.UTC)
+	blackouts := `
+- name: release-freeze
+  start: "2017-12-20T00:00:00Z"
+  end: "2018-01-03T00:00:00Z"
+- name: migration
+  start: "2018-01-10T22:00:00Z"
+  end: "2018-01-11T02:00:00Z"
+`
+	tests := map[string]struct {
+		data   map[string]string
+		reason string
+	}{
+		"Missing":      {nil, ""},
+		"Resumed":      {map[string]string{policySuspendedKey: "false"}, ""},
+		"KillSwitch":   {map[string]string{policySuspendedKey: "true", policyReasonKey: "Incident 42"}, suspendedByKillSwitch},
+		"Blackout":     {map[string]string{policyBlackoutsKey: blackouts}, suspendedByBlackout},
+		"InvalidBool":  {map[string]string{policySuspendedKey: "yes please"}, suspendedByBadPolicy},
+		"InvalidYAML":  {map[string]string{policyBlackoutsKey: "- name: [unclosed"}, suspendedByBadPolicy},
+		"InvalidRange": {map[string]string{policyBlackoutsKey: `[{"name": "backwards", "start": "2018-01-03T00:00:00Z", "end": "2017-12-20T00:00:00Z"}]`}, suspendedByBadPolicy},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cm *v1.ConfigMap
+			if test.data != nil {
+				cm = &v1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: policyConfigMap}, Data: test.data}
+			}
+			s := parsePolicy(cm).suspension(now)
+			if test.reason == "" && s != nil {
+				t.Errorf("Expected no suspension, but found %+v", s)
+			} else if test.reason != "" && (s == nil || s.reason != test.reason) {
+				t.Errorf("Expected suspension for %v, but found %+v", test.reason, s)
+			}
+		})
+	}
+
+	p := parsePolicy(&v1.ConfigMap{Data: map[string]string{policyBlackoutsKey: blackouts}})
+	for _, transition := range []struct {
+		now, next time.Time
+	}{
+		{now, time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2018, 1, 10, 22, 0, 0, 0, time.UTC)},
+	} {
+		if next, ok := p.nextTransition(transition.now); !ok || !next.Equal(transition.next) {
+			t.Errorf("Expected the transition after %v to be %v, but found %v", transition.now, transition.next, next)
+		}
+	}
+	if _, ok := p.nextTransition(time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("Expected no transition after the last blackout")
+	}
+}
+
+func TestReconcileSuspended(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	faultInjectors.Add(sources[0])
+	key := "test-namespace-one/" + sources[0].ObjectMeta.Name
+	reconcile := func(t *testing.T) *spec.FaultInjector {
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		c.store.Update(obj)
+		if err := c.Reconcile(key); err != nil {
+			t.Fatalf("Found unexpected error when reconciling resource: %v", err)
+		}
+		obj, err = faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		return obj
+	}
+	validateReplicas := func(t *testing.T, expected int32) {
+		deployment := c.getDownstreamState(sources[0])
+		if deployment == nil || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != expected {
+			t.Errorf("Expected the deployment to have %v replicas, but found %v", expected, deployment)
+		}
+	}
+
+	reconcile(t)
+	validateReplicas(t, downstreamReplicas)
+
+	c.setPolicy(parsePolicy(&v1.ConfigMap{Data: map[string]string{policySuspendedKey: "true", policyReasonKey: "Incident 42"}}))
+	obj := reconcile(t)
+	validateReplicas(t, 0)
+	if obj.Status.Phase != spec.FaultInjectorSuspended || conditionStatus(obj.Status.Conditions, spec.FaultInjectorSuspendedCondition) != v1.ConditionTrue {
+		t.Errorf("Expected the FaultInjector to be suspended, but found status %+v", obj.Status)
+	}
+	validateEvents(t, recorder, "Normal Suspended Stopping injectors: Suspended by ConfigMap fault-injector-policy: Incident 42")
+
+	c.setPolicy(parsePolicy(nil))
+	obj = reconcile(t)
+	validateReplicas(t, downstreamReplicas)
+	if obj.Status.Phase == spec.FaultInjectorSuspended || conditionStatus(obj.Status.Conditions, spec.FaultInjectorSuspendedCondition) != v1.ConditionFalse {
+		t.Errorf("Expected the FaultInjector to be resumed, but found status %+v", obj.Status)
+	}
+	validateEvents(t, recorder, "Normal Resumed Restarting injectors")
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// statusUpdateRetries is the number of times a status update is attempted
+// when it conflicts with a concurrent update, e.g. by an injector.
+const statusUpdateRetries = 3
+
+// updateStatus writes the status of a FaultInjector after it was reconciled,
+// given the error returned by reconciliation. The FaultInjector is only
+// updated if its status changed, so that the update it triggers settles.
+func (c *FaultInjectorController) updateStatus(obj *spec.FaultInjector, reconcileErr error) error {
+	if c.faultInjectors == nil {
+		return nil
+	}
+	for i := 0; i < statusUpdateRetries; i++ {
+		status := c.generateStatus(obj, reconcileErr)
+		if reflect.DeepEqual(status, obj.Status) {
+			return nil
+		}
+		updated := *obj
+		updated.Status = status
+		_, err := c.faultInjectors.UpdateStatus(&updated)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		obj, err = c.faultInjectors.Get(obj.ObjectMeta.Namespace, obj.ObjectMeta.Name)
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("Error when updating status of FaultInjector %v: gave up after %v conflicts", obj.ObjectMeta.Name, statusUpdateRetries)
+}
+
+// generateStatus returns the status of a FaultInjector reflecting the result
+// of its reconciliation and the state of its Deployment. The fields written
+// by the injectors are carried over unchanged.
+func (c *FaultInjectorController) generateStatus(obj *spec.FaultInjector, reconcileErr error) spec.FaultInjectorStatus {
+	status := obj.Status
+	status.ObservedGeneration = obj.ObjectMeta.Generation
+	status.Conditions = append([]spec.FaultInjectorCondition(nil), obj.Status.Conditions...)
+
+	if refused, ok := reconcileErr.(*refusal); ok {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorAccepted, v1.ConditionFalse,
+			refused.reason, refused.message)
+	} else if reconcileErr != nil {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorAccepted, v1.ConditionFalse,
+			"ReconcileFailed", reconcileErr.Error())
+	} else {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorAccepted, v1.ConditionTrue,
+			"Reconciled", "")
+	}
+
+	// An invalid lifetime is reported by the Accepted condition, and leaves
+	// the FaultInjector running.
+	l, _ := faultInjectorLifetime(obj)
+	now := time.Now()
+	completed := l.completed(now)
+
+	status.Deployment = ""
+	downstreamObj := c.getDownstreamState(obj)
+	if downstreamObj == nil {
+		reason, message := "DeploymentNotFound", fmt.Sprintf("Deployment %v does not exist", formatDownstreamName(obj))
+		switch {
+		case l.notStarted(now):
+			reason, message = "NotStarted", fmt.Sprintf("Injecting faults from %v", l.start.Format(time.RFC3339))
+		case completed:
+			reason, message = "Completed", ""
+		}
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorReady, v1.ConditionFalse,
+			reason, message)
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorDegraded, v1.ConditionFalse,
+			reason, "")
+	} else {
+		status.Deployment = downstreamObj.ObjectMeta.Name
+		available := downstreamObj.Status.AvailableReplicas
+		unavailable := downstreamObj.Status.UnavailableReplicas
+		if available > 0 {
+			status.Conditions = setCondition(status.Conditions, spec.FaultInjectorReady, v1.ConditionTrue,
+				"InjectorsAvailable", "")
+		} else {
+			status.Conditions = setCondition(status.Conditions, spec.FaultInjectorReady, v1.ConditionFalse,
+				"NoInjectorsAvailable", "")
+		}
+		if unavailable > 0 {
+			status.Conditions = setCondition(status.Conditions, spec.FaultInjectorDegraded, v1.ConditionTrue,
+				"InjectorsUnavailable", fmt.Sprintf("%v of %v injectors are unavailable", unavailable, available+unavailable))
+		} else {
+			status.Conditions = setCondition(status.Conditions, spec.FaultInjectorDegraded, v1.ConditionFalse,
+				"InjectorsAvailable", "")
+		}
+	}
+
+	// The Paused condition is only reported once a FaultInjector has been
+	// paused.
+	if obj.Spec.Paused {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorPausedCondition, v1.ConditionTrue,
+			"Paused", "spec.paused is set")
+	} else if conditionStatus(status.Conditions, spec.FaultInjectorPausedCondition) != v1.ConditionUnknown {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorPausedCondition, v1.ConditionFalse,
+			"Resumed", "")
+	}
+
+	// The Suspended condition is only reported once a FaultInjector has been
+	// suspended.
+	suspension := c.suspension()
+	if suspension != nil {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorSuspendedCondition, v1.ConditionTrue,
+			suspension.reason, suspension.message)
+	} else if conditionStatus(status.Conditions, spec.FaultInjectorSuspendedCondition) != v1.ConditionUnknown {
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorSuspendedCondition, v1.ConditionFalse,
+			"Resumed", "")
+	}
+
+	// The Completed condition is only reported once a FaultInjector has
+	// completed, and is reset if its end time is moved into the future.
+	if completed {
+		if status.CompletionTime == nil {
+			completionTime := unversioned.NewTime(l.end)
+			status.CompletionTime = &completionTime
+		}
+		status.Conditions = setCondition(status.Conditions, spec.FaultInjectorCompletedCondition, v1.ConditionTrue,
+			"Completed", fmt.Sprintf("Stopped injecting faults at %v", l.end.Format(time.RFC3339)))
+	} else {
+		status.CompletionTime = nil
+		if conditionStatus(status.Conditions, spec.FaultInjectorCompletedCondition) != v1.ConditionUnknown {
+			status.Conditions = setCondition(status.Conditions, spec.FaultInjectorCompletedCondition, v1.ConditionFalse,
+				"Restarted", "")
+		}
+	}
+
+	switch {
+	case conditionStatus(status.Conditions, spec.FaultInjectorAccepted) != v1.ConditionTrue:
+		status.Phase = spec.FaultInjectorFailed
+	case completed:
+		status.Phase = spec.FaultInjectorCompleted
+	case suspension != nil:
+		status.Phase = spec.FaultInjectorSuspended
+	case obj.Spec.Paused:
+		status.Phase = spec.FaultInjectorPaused
+	case conditionStatus(status.Conditions, spec.FaultInjectorReady) == v1.ConditionTrue:
+		status.Phase = spec.FaultInjectorRunning
+	default:
+		status.Phase = spec.FaultInjectorPending
+	}
+	if obj.ObjectMeta.DeletionTimestamp != nil {
+		status.Phase = spec.FaultInjectorTerminating
+	}
+	return status
+}
+
+// setCondition sets a condition in a list of conditions, replacing any
+// existing condition of the same type. The last transition time is only
+// moved forward if the status of the condition changed.
+func setCondition(conditions []spec.FaultInjectorCondition, conditionType spec.FaultInjectorConditionType,
+	status v1.ConditionStatus, reason, message string) []spec.FaultInjectorCondition {
+	condition := spec.FaultInjectorCondition{
+		Type:               conditionType,
+		Status:             status,
+		LastTransitionTime: unversioned.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	for i := range conditions {
+		if conditions[i].Type != conditionType {
+			continue
+		}
+		if conditions[i].Status == status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
+
+// conditionStatus returns the status of the condition of the given type, or
+// ConditionUnknown if it is not set.
+func conditionStatus(conditions []spec.FaultInjectorCondition, conditionType spec.FaultInjectorConditionType) v1.ConditionStatus {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+	return v1.ConditionUnknown
+}
+
+// conditionReason returns the reason of the condition of the given type, or
+// an empty string if it is not set.
+func conditionReason(conditions []spec.FaultInjectorCondition, conditionType spec.FaultInjectorConditionType) string {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition.Reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestUpdateStatus(t *testing.T) {
+	c, _ := prepareResourceHandlerTest()
+	clientset := c.kclient.(*fkubernetes.Clientset)
+	faultInjectors := c.faultInjectors.(*ffaultinjectors.Client)
+
+	sources, err := generateTestFaultInjectors(1)
+	if err != nil {
+		t.Fatalf("Error when generating resources for test: %v", err)
+	}
+	lastFaultTime := unversioned.Now()
+	sources[0].Status.LastFaultTime = &lastFaultTime
+	sources[0].Status.TotalFaults = 5
+	faultInjectors.Add(sources[0])
+
+	getFaultInjector := func(t *testing.T) *spec.FaultInjector {
+		obj, err := faultInjectors.Get(sources[0].ObjectMeta.Namespace, sources[0].ObjectMeta.Name)
+		if err != nil {
+			t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+		}
+		return obj
+	}
+
+	t.Run("Failed", func(t *testing.T) {
+		obj := getFaultInjector(t)
+		if err := c.updateStatus(obj, errors.New("invalid spec")); err != nil {
+			t.Fatalf("Found unexpected error when updating status: %v", err)
+		}
+		obj = getFaultInjector(t)
+		validateStatus(t, obj.Status, spec.FaultInjectorFailed, map[spec.FaultInjectorConditionType]v1.ConditionStatus{
+			spec.FaultInjectorAccepted: v1.ConditionFalse,
+			spec.FaultInjectorReady:    v1.ConditionFalse,
+			spec.FaultInjectorDegraded: v1.ConditionFalse,
+		})
+		if obj.Status.Deployment != "" {
+			t.Errorf("Expected no deployment in status, but found %v", obj.Status.Deployment)
+		}
+	})
+
+	t.Run("Pending", func(t *testing.T) {
+		obj := getFaultInjector(t)
+		if err := c.addFaultInjector(obj); err != nil {
+			t.Fatalf("Found unexpected error when adding resource: %v", err)
+		}
+		if err := c.updateStatus(obj, nil); err != nil {
+			t.Fatalf("Found unexpected error when updating status: %v", err)
+		}
+		obj = getFaultInjector(t)
+		validateStatus(t, obj.Status, spec.FaultInjectorPending, map[spec.FaultInjectorConditionType]v1.ConditionStatus{
+			spec.FaultInjectorAccepted: v1.ConditionTrue,
+			spec.FaultInjectorReady:    v1.ConditionFalse,
+			spec.FaultInjectorDegraded: v1.ConditionFalse,
+		})
+		if obj.Status.Deployment != formatDownstreamName(obj) {
+			t.Errorf("Expected deployment %v in status, but found %v", formatDownstreamName(obj), obj.Status.Deployment)
+		}
+		if obj.Status.TotalFaults != 5 || obj.Status.LastFaultTime == nil {
+			t.Errorf("Expected the fault counters to be preserved, but found %v and %v", obj.Status.TotalFaults, obj.Status.LastFaultTime)
+		}
+	})
+
+	t.Run("Running", func(t *testing.T) {
+		deployment := c.getDownstreamState(sources[0])
+		deployment.Status.AvailableReplicas = 1
+		deployment.Status.UnavailableReplicas = 1
+		if _, err := clientset.Extensions().Deployments(deployment.ObjectMeta.Namespace).Update(deployment); err != nil {
+			t.Fatalf("Found unexpected error when preparing deployment: %v", err)
+		}
+		obj := getFaultInjector(t)
+		accepted := obj.Status.Conditions[0]
+		if err := c.updateStatus(obj, nil); err != nil {
+			t.Fatalf("Found unexpected error when updating status: %v", err)
+		}
+		obj = getFaultInjector(t)
+		validateStatus(t, obj.Status, spec.FaultInjectorRunning, map[spec.FaultInjectorConditionType]v1.ConditionStatus{
+			spec.FaultInjectorAccepted: v1.ConditionTrue,
+			spec.FaultInjectorReady:    v1.ConditionTrue,
+			spec.FaultInjectorDegraded: v1.ConditionTrue,
+		})
+		if !obj.Status.Conditions[0].LastTransitionTime.Equal(accepted.LastTransitionTime) {
+			t.Errorf("Expected the transition time of an unchanged condition to be preserved")
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		obj := getFaultInjector(t)
+		if err := c.updateStatus(obj, nil); err != nil {
+			t.Fatalf("Found unexpected error when updating status: %v", err)
+		}
+		if version := getFaultInjector(t).ObjectMeta.ResourceVersion; version != obj.ObjectMeta.ResourceVersion {
+			t.Errorf("Expected no update when the status is unchanged, but the resource version changed from %v to %v",
+				obj.ObjectMeta.ResourceVersion, version)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		obj := getFaultInjector(t)
+		stale := *obj
+		obj.Status.TotalFaults = 6
+		faultInjectors.Add(obj)
+		if err := c.updateStatus(&stale, errors.New("invalid spec")); err != nil {
+			t.Fatalf("Found unexpected error when updating status: %v", err)
+		}
+		obj = getFaultInjector(t)
+		if obj.Status.Phase != spec.FaultInjectorFailed {
+			t.Errorf("Expected phase %v, but found %v", spec.FaultInjectorFailed, obj.Status.Phase)
+		}
+		if obj.Status.TotalFaults != 6 {
+			t.Errorf("Expected the concurrent update to be preserved, but found %v total faults", obj.Status.TotalFaults)
+		}
+	})
+}
+
+func validateStatus(t *testing.T, status spec.FaultInjectorStatus, phase spec.FaultInjectorPhase,
+	conditions map[spec.FaultInjectorConditionType]v1.ConditionStatus) {
+	if status.Phase != phase {
+		t.Errorf("Expected phase %v, but found %v", phase, status.Phase)
+	}
+	if len(status.Conditions) != len(conditions) {
+		t.Errorf("Expected %v conditions, but found %v", len(conditions), status.Conditions)
+	}
+	for conditionType, expected := range conditions {
+		if found := conditionStatus(status.Conditions, conditionType); found != expected {
+			t.Errorf("Expected condition %v to be %v, but found %v", conditionType, expected, found)
+		}
+	}
+}
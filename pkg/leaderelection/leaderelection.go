@@ -0,0 +1,296 @@
+// Package leaderelection implements leader election between replicas of a
+// controller, using an annotation on a ConfigMap as the lock.
+//
+// The holder of the lock renews it every RetryPeriod. Other candidates only
+// take the lock over once it has not been renewed for LeaseDuration, as
+// measured by their own clocks, so clock skew between nodes does not matter.
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/util/wait"
+)
+
+// LeaderAnnotation is the annotation holding the LeaderElectionRecord on the
+// lock ConfigMap.
+const LeaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// jitterFactor is the maximum fraction of RetryPeriod added to each wait.
+const jitterFactor = 1.2
+
+// LeaderElectionRecord describes the current holder of a lock.
+type LeaderElectionRecord struct {
+	HolderIdentity       string           `json:"holderIdentity"`
+	LeaseDurationSeconds int              `json:"leaseDurationSeconds"`
+	AcquireTime          unversioned.Time `json:"acquireTime"`
+	RenewTime            unversioned.Time `json:"renewTime"`
+	LeaderTransitions    int              `json:"leaderTransitions"`
+}
+
+// Config holds configuration parameters for a LeaderElector.
+type Config struct {
+	// Namespace and Name identify the ConfigMap used as the lock.
+	Namespace string
+	Name      string
+	// Identity uniquely identifies this candidate, e.g. its Pod name.
+	Identity string
+	// LeaseDuration is how long candidates wait after the last renewal
+	// before taking over the lock.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps trying to renew the lock
+	// before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is how long candidates wait between attempts to acquire or
+	// renew the lock.
+	RetryPeriod time.Duration
+	// OnStartedLeading is called once this candidate becomes the leader. The
+	// channel it is given is closed when leadership is lost.
+	OnStartedLeading func(stop <-chan struct{})
+	// OnStoppedLeading is called when this candidate loses leadership.
+	OnStoppedLeading func()
+}
+
+// LeaderElector takes part in the election of a leader.
+type LeaderElector struct {
+	kclient kubernetes.Interface
+	config  Config
+
+	observedRecord LeaderElectionRecord
+	observedTime   time.Time
+	now            func() time.Time
+}
+
+// New creates a new LeaderElector.
+func New(kclient kubernetes.Interface, conf Config) (*LeaderElector, error) {
+	if conf.Name == "" || conf.Namespace == "" {
+		return nil, fmt.Errorf("Leader election requires the namespace and name of a lock")
+	}
+	if conf.Identity == "" {
+		return nil, fmt.Errorf("Leader election requires an identity")
+	}
+	if conf.RetryPeriod <= 0 {
+		return nil, fmt.Errorf("Retry period must be positive, but got %v", conf.RetryPeriod)
+	}
+	if conf.RenewDeadline <= time.Duration(jitterFactor*float64(conf.RetryPeriod)) {
+		return nil, fmt.Errorf("Renew deadline must be greater than %v times the retry period %v, but got %v", jitterFactor, conf.RetryPeriod, conf.RenewDeadline)
+	}
+	if conf.LeaseDuration <= conf.RenewDeadline {
+		return nil, fmt.Errorf("Lease duration must be greater than the renew deadline %v, but got %v", conf.RenewDeadline, conf.LeaseDuration)
+	}
+	if conf.OnStartedLeading == nil || conf.OnStoppedLeading == nil {
+		return nil, fmt.Errorf("Leader election requires both OnStartedLeading and OnStoppedLeading callbacks")
+	}
+	return &LeaderElector{
+		kclient: kclient,
+		config:  conf,
+		now:     time.Now,
+	}, nil
+}
+
+// Run waits until this candidate becomes the leader, then calls
+// OnStartedLeading and renews the lock until OnStartedLeading returns, a
+// renewal does not succeed within the renew deadline, or stopChan is closed.
+// It returns once OnStartedLeading has returned. Unless a renewal failed, the
+// lock is released first, so that another candidate can take over at once.
+func (le *LeaderElector) Run(stopChan <-chan struct{}) {
+	if !le.acquire(stopChan) {
+		return
+	}
+	leading := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		le.config.OnStartedLeading(leading)
+	}()
+	le.renew(stopChan, done)
+	held := false
+	select {
+	case <-stopChan:
+		held = true
+	case <-done:
+		held = true
+	default:
+	}
+	close(leading)
+	<-done
+	if held {
+		le.release()
+	}
+	le.config.OnStoppedLeading()
+}
+
+// acquire tries to acquire the lock every RetryPeriod until it succeeds, and
+// returns false if stopChan is closed first.
+func (le *LeaderElector) acquire(stopChan <-chan struct{}) bool {
+	acquired := false
+	stop := make(chan struct{})
+	wait.JitterUntil(func() {
+		select {
+		case <-stopChan:
+			close(stop)
+			return
+		default:
+		}
+		if le.tryAcquireOrRenew() {
+			fmt.Printf("%v acquired the lock %v/%v\n", le.config.Identity, le.config.Namespace, le.config.Name)
+			acquired = true
+			close(stop)
+		}
+	}, le.config.RetryPeriod, jitterFactor, true, stop)
+	return acquired
+}
+
+// renew renews the lock every RetryPeriod, and returns once a renewal has not
+// succeeded within RenewDeadline, or either stopChan or done is closed.
+func (le *LeaderElector) renew(stopChan, done <-chan struct{}) {
+	stopped := func() bool {
+		select {
+		case <-stopChan:
+			return true
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+	for {
+		err := wait.Poll(le.config.RetryPeriod, le.config.RenewDeadline, func() (bool, error) {
+			if stopped() {
+				return true, nil
+			}
+			return le.tryAcquireOrRenew(), nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v failed to renew the lock %v/%v: %v\n", le.config.Identity, le.config.Namespace, le.config.Name, err)
+			return
+		}
+		if stopped() {
+			return
+		}
+	}
+}
+
+// tryAcquireOrRenew acquires the lock if it is free or has expired, or renews
+// it if this candidate already holds it. It returns whether this candidate
+// holds the lock.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := unversioned.NewTime(le.now())
+	record := LeaderElectionRecord{
+		HolderIdentity:       le.config.Identity,
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	configMaps := le.kclient.Core().ConfigMaps(le.config.Namespace)
+	lock, err := configMaps.Get(le.config.Name)
+	if apierrors.IsNotFound(err) {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return false
+		}
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        le.config.Name,
+				Namespace:   le.config.Namespace,
+				Annotations: map[string]string{LeaderAnnotation: string(b)},
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error when creating the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		le.observe(record)
+		return true
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error when getting the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+
+	var oldRecord LeaderElectionRecord
+	if value, ok := lock.ObjectMeta.Annotations[LeaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &oldRecord); err != nil {
+			fmt.Fprintf(os.Stderr, "Error when parsing the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+	}
+	if !reflect.DeepEqual(oldRecord, le.observedRecord) {
+		le.observe(oldRecord)
+	}
+	if oldRecord.HolderIdentity != "" && oldRecord.HolderIdentity != le.config.Identity &&
+		le.observedTime.Add(le.config.LeaseDuration).After(now.Time) {
+		return false
+	}
+
+	if oldRecord.HolderIdentity == le.config.Identity {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return false
+	}
+	annotations := make(map[string]string)
+	for k, v := range lock.ObjectMeta.Annotations {
+		annotations[k] = v
+	}
+	annotations[LeaderAnnotation] = string(b)
+	lock.ObjectMeta.Annotations = annotations
+	if _, err := configMaps.Update(lock); err != nil {
+		fmt.Fprintf(os.Stderr, "Error when updating the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	le.observe(record)
+	return true
+}
+
+// release gives up the lock if this candidate holds it.
+func (le *LeaderElector) release() {
+	configMaps := le.kclient.Core().ConfigMaps(le.config.Namespace)
+	lock, err := configMaps.Get(le.config.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error when releasing the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	var record LeaderElectionRecord
+	if err := json.Unmarshal([]byte(lock.ObjectMeta.Annotations[LeaderAnnotation]), &record); err != nil || record.HolderIdentity != le.config.Identity {
+		return
+	}
+	now := unversioned.NewTime(le.now())
+	record.HolderIdentity = ""
+	record.LeaseDurationSeconds = 1
+	record.AcquireTime = now
+	record.RenewTime = now
+	b, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	annotations := make(map[string]string)
+	for k, v := range lock.ObjectMeta.Annotations {
+		annotations[k] = v
+	}
+	annotations[LeaderAnnotation] = string(b)
+	lock.ObjectMeta.Annotations = annotations
+	if _, err := configMaps.Update(lock); err != nil {
+		fmt.Fprintf(os.Stderr, "Error when releasing the lock %v/%v: %v\n", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	fmt.Printf("%v released the lock %v/%v\n", le.config.Identity, le.config.Namespace, le.config.Name)
+}
+
+// observe records when a change of the lock was last seen.
+func (le *LeaderElector) observe(record LeaderElectionRecord) {
+	le.observedRecord = record
+	le.observedTime = le.now()
+}
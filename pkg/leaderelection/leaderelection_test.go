@@ -0,0 +1,188 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.5/kubernetes"
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+)
+
+func newTestElector(t *testing.T, kclient kubernetes.Interface, identity string, now *time.Time) *LeaderElector {
+	le, err := New(kclient, Config{
+		Namespace:        "lanthanides",
+		Name:             "cerium",
+		Identity:         identity,
+		LeaseDuration:    15 * time.Second,
+		RenewDeadline:    10 * time.Second,
+		RetryPeriod:      2 * time.Second,
+		OnStartedLeading: func(<-chan struct{}) {},
+		OnStoppedLeading: func() {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.now = func() time.Time { return *now }
+	return le
+}
+
+func getRecord(t *testing.T, kclient kubernetes.Interface) LeaderElectionRecord {
+	lock, err := kclient.Core().ConfigMaps("lanthanides").Get("cerium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record LeaderElectionRecord
+	if err := json.Unmarshal([]byte(lock.Annotations[LeaderAnnotation]), &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestNew(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config Config
+	}{
+		{"No Identity", Config{Namespace: "lanthanides", Name: "cerium", LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 2 * time.Second}},
+		{"Renew Deadline Too Long", Config{Namespace: "lanthanides", Name: "cerium", Identity: "a", LeaseDuration: 10 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 2 * time.Second}},
+		{"Retry Period Too Long", Config{Namespace: "lanthanides", Name: "cerium", Identity: "a", LeaseDuration: 15 * time.Second, RenewDeadline: 10 * time.Second, RetryPeriod: 9 * time.Second}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.OnStartedLeading = func(<-chan struct{}) {}
+			test.config.OnStoppedLeading = func() {}
+			if _, err := New(fkubernetes.NewSimpleClientset(), test.config); err == nil {
+				t.Errorf("Expected an error for %+v", test.config)
+			}
+		})
+	}
+}
+
+func TestTryAcquireOrRenew(t *testing.T) {
+	kclient := fkubernetes.NewSimpleClientset()
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	leader := newTestElector(t, kclient, "leader", &now)
+	standby := newTestElector(t, kclient, "standby", &now)
+
+	if !leader.tryAcquireOrRenew() {
+		t.Fatalf("Expected the leader to acquire a missing lock")
+	}
+	acquired := getRecord(t, kclient)
+	if acquired.HolderIdentity != "leader" || acquired.LeaseDurationSeconds != 15 {
+		t.Errorf("Expected the lock to be held by leader for 15s, but found %+v", acquired)
+	}
+	if standby.tryAcquireOrRenew() {
+		t.Errorf("Expected the standby not to acquire a held lock")
+	}
+
+	now = now.Add(10 * time.Second)
+	if !leader.tryAcquireOrRenew() {
+		t.Fatalf("Expected the leader to renew its lock")
+	}
+	renewed := getRecord(t, kclient)
+	if !renewed.AcquireTime.Equal(acquired.AcquireTime) || !renewed.RenewTime.Time.Equal(now) {
+		t.Errorf("Expected renewal to keep the acquire time and update the renew time, but found %+v", renewed)
+	}
+
+	// The standby measures the lease from when it saw the last renewal.
+	now = now.Add(10 * time.Second)
+	if standby.tryAcquireOrRenew() {
+		t.Errorf("Expected the standby not to acquire the lock before the lease expired")
+	}
+	now = now.Add(16 * time.Second)
+	if !standby.tryAcquireOrRenew() {
+		t.Fatalf("Expected the standby to acquire an expired lock")
+	}
+	taken := getRecord(t, kclient)
+	if taken.HolderIdentity != "standby" || taken.LeaderTransitions != 1 || !taken.AcquireTime.Time.Equal(now) {
+		t.Errorf("Expected the standby to take over the lock, but found %+v", taken)
+	}
+	if leader.tryAcquireOrRenew() {
+		t.Errorf("Expected the former leader not to renew a lock it lost")
+	}
+}
+
+func TestRun(t *testing.T) {
+	kclient := fkubernetes.NewSimpleClientset()
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	le, err := New(kclient, Config{
+		Namespace:     "lanthanides",
+		Name:          "cerium",
+		Identity:      "leader",
+		LeaseDuration: 150 * time.Millisecond,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   20 * time.Millisecond,
+		OnStartedLeading: func(stop <-chan struct{}) {
+			close(started)
+			<-stop
+		},
+		OnStoppedLeading: func() {
+			close(stopped)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		le.Run(stop)
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected to start leading")
+	}
+	if record := getRecord(t, kclient); record.HolderIdentity != "leader" {
+		t.Errorf("Expected the lock to be held by leader, but found %+v", record)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Run to return once stopped")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("Expected OnStoppedLeading to be called")
+	}
+	if record := getRecord(t, kclient); record.HolderIdentity != "" {
+		t.Errorf("Expected the lock to be released once stopped, but found %+v", record)
+	}
+}
+
+func TestRunReturned(t *testing.T) {
+	kclient := fkubernetes.NewSimpleClientset()
+	le, err := New(kclient, Config{
+		Namespace:        "lanthanides",
+		Name:             "cerium",
+		Identity:         "leader",
+		LeaseDuration:    150 * time.Millisecond,
+		RenewDeadline:    100 * time.Millisecond,
+		RetryPeriod:      20 * time.Millisecond,
+		OnStartedLeading: func(stop <-chan struct{}) {},
+		OnStoppedLeading: func() {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		le.Run(make(chan struct{}))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Run to return once OnStartedLeading returned")
+	}
+	if record := getRecord(t, kclient); record.HolderIdentity != "" {
+		t.Errorf("Expected the lock to be released once OnStartedLeading returned, but found %+v", record)
+	}
+}
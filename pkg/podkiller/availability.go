@@ -0,0 +1,198 @@
+package podkiller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/pods"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/types"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+// availability tracks the available pods of each controller in a namespace,
+// so that no victim drops its controller below the minimum availability.
+type availability struct {
+	minAvailable intstr.IntOrString
+	// owners maps the UID of the controller owning a pod to the counts of
+	// the controller whose scale it belongs to, e.g. that of the Deployment
+	// owning a ReplicaSet.
+	owners map[types.UID]*ownerAvailability
+}
+
+// ownerAvailability counts the pods of a controller.
+type ownerAvailability struct {
+	kind, name string
+	// replicas is the desired number of pods, or -1 for a controller with
+	// no scale, whose existing pods are counted instead.
+	replicas         int
+	available, total int
+}
+
+// newAvailability counts the available pods of each controller among the
+// given pods. A minimum given as a percentage is taken of the replicas the
+// controller wants, like a PodDisruptionBudget does, so that missing pods do
+// not lower it.
+func (p *PodKiller) newAvailability(namespacePods []v1.Pod) (*availability, error) {
+	a := &availability{minAvailable: *p.minAvailable, owners: make(map[types.UID]*ownerAvailability)}
+	scales := make(map[types.UID]*ownerAvailability)
+	for _, pod := range namespacePods {
+		owner := pods.ControllerOf(pod.ObjectMeta)
+		if owner == nil {
+			continue
+		}
+		counts, ok := a.owners[owner.UID]
+		if !ok {
+			s, err := p.scaleOf(*owner)
+			if err != nil {
+				return nil, fmt.Errorf("Error when getting the scale of %v %v: %v", owner.Kind, owner.Name, err)
+			}
+			if counts, ok = scales[s.uid]; !ok {
+				counts = &ownerAvailability{kind: s.kind, name: s.name, replicas: s.replicas}
+				scales[s.uid] = counts
+			}
+			a.owners[owner.UID] = counts
+		}
+		if pod.ObjectMeta.DeletionTimestamp == nil {
+			counts.total++
+		}
+		if pods.IsAvailable(pod) {
+			counts.available++
+		}
+	}
+	return a, nil
+}
+
+// check returns why killing a pod would drop its controller below the
+// minimum availability, or an empty string if it would not. Pods with no
+// controller, and pods which are not available, may always be killed.
+func (a *availability) check(pod v1.Pod) string {
+	owner := pods.ControllerOf(pod.ObjectMeta)
+	if owner == nil || !pods.IsAvailable(pod) {
+		return ""
+	}
+	counts, ok := a.owners[owner.UID]
+	if !ok {
+		return ""
+	}
+	desired := counts.replicas
+	if desired < 0 {
+		desired = counts.total
+	}
+	required, err := intstr.GetValueFromIntOrPercent(&a.minAvailable, desired, true)
+	if err != nil {
+		return err.Error()
+	}
+	if counts.available-1 < required {
+		return fmt.Sprintf("%v %v has %v of %v pods available, and requires %v", counts.kind, counts.name, counts.available, desired, a.minAvailable.String())
+	}
+	return ""
+}
+
+// record counts a killed pod as no longer available.
+func (a *availability) record(pod v1.Pod) {
+	owner := pods.ControllerOf(pod.ObjectMeta)
+	if owner == nil || !pods.IsAvailable(pod) {
+		return
+	}
+	if counts, ok := a.owners[owner.UID]; ok {
+		counts.available--
+	}
+}
+
+// scale is the controller whose desired replicas the pods of an owner count
+// towards.
+type scale struct {
+	uid        types.UID
+	kind, name string
+	replicas   int
+}
+
+// scaleOf returns the scale which the pods owned by a controller count
+// towards. Pods of a ReplicaSet owned by a Deployment count towards the
+// Deployment, so that a rollout cannot take it below the minimum. Controllers
+// with no scale, such as DaemonSets, or which no longer exist, have -1
+// replicas.
+func (p *PodKiller) scaleOf(owner v1.OwnerReference) (scale, error) {
+	s := scale{uid: owner.UID, kind: owner.Kind, name: owner.Name, replicas: -1}
+	switch owner.Kind {
+	case "ReplicaSet":
+		rs, err := p.kclient.Extensions().ReplicaSets(p.namespace).Get(owner.Name)
+		if err != nil {
+			return unscaled(s, err)
+		}
+		deploymentRef := pods.ControllerOf(rs.ObjectMeta)
+		if deploymentRef == nil || deploymentRef.Kind != "Deployment" {
+			return s.withReplicas(rs.Spec.Replicas), nil
+		}
+		deployment, err := p.kclient.Extensions().Deployments(p.namespace).Get(deploymentRef.Name)
+		if apierrors.IsNotFound(err) {
+			return s.withReplicas(rs.Spec.Replicas), nil
+		} else if err != nil {
+			return s, err
+		}
+		s.uid, s.kind, s.name = deployment.ObjectMeta.UID, "Deployment", deployment.ObjectMeta.Name
+		return s.withReplicas(deployment.Spec.Replicas), nil
+	case "ReplicationController":
+		rc, err := p.kclient.Core().ReplicationControllers(p.namespace).Get(owner.Name)
+		if err != nil {
+			return unscaled(s, err)
+		}
+		return s.withReplicas(rc.Spec.Replicas), nil
+	case "StatefulSet":
+		if p.statefulSets == nil {
+			return s, nil
+		}
+		b, err := p.statefulSets.Get().
+			Namespace(p.namespace).
+			Resource("statefulsets").
+			Name(owner.Name).
+			DoRaw()
+		if err != nil {
+			return unscaled(s, err)
+		}
+		var statefulSet struct {
+			Spec struct {
+				Replicas *int32 `json:"replicas"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(b, &statefulSet); err != nil {
+			return s, err
+		}
+		return s.withReplicas(statefulSet.Spec.Replicas), nil
+	default:
+		return s, nil
+	}
+}
+
+// withReplicas returns the scale with the given desired replicas, which
+// default to 1 if unset.
+func (s scale) withReplicas(replicas *int32) scale {
+	s.replicas = 1
+	if replicas != nil {
+		s.replicas = int(*replicas)
+	}
+	return s
+}
+
+// unscaled returns a scale with no desired replicas if its controller no
+// longer exists, or the error from getting it otherwise.
+func unscaled(s scale, err error) (scale, error) {
+	if apierrors.IsNotFound(err) {
+		return s, nil
+	}
+	return s, err
+}
+
+// listNamespacePods returns every pod in the namespace, so that the
+// availability of a controller accounts for the pods outside the selectors.
+func (p *PodKiller) listNamespacePods() ([]v1.Pod, error) {
+	list, err := p.kclient.Core().Pods(p.namespace).List(api.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
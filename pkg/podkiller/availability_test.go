@@ -0,0 +1,210 @@
+package podkiller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	"k8s.io/client-go/1.5/pkg/types"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+func TestAvailability(t *testing.T) {
+	pods := []v1.Pod{
+		ownedPod("cerium-1", "cerium", true),
+		ownedPod("cerium-2", "cerium", true),
+		ownedPod("cerium-3", "cerium", true),
+		ownedPod("cerium-4", "cerium", false),
+		ownedPod("erbium-1", "erbium", true),
+		{ObjectMeta: v1.ObjectMeta{Name: "orphan"}},
+	}
+	tests := map[string]struct {
+		minAvailable intstr.IntOrString
+		spared       []string
+	}{
+		// Killing one cerium pod leaves 2 of 4 ready, and a second would
+		// leave 1 of 4.
+		"Number":  {intstr.FromInt(2), []string{"cerium-2", "cerium-3", "erbium-1"}},
+		"Percent": {intstr.FromString("50%"), []string{"cerium-2", "cerium-3", "erbium-1"}},
+		"Zero":    {intstr.FromInt(0), nil},
+		"All":     {intstr.FromString("100%"), []string{"cerium-1", "cerium-2", "cerium-3", "erbium-1"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			minAvailable := test.minAvailable
+			p := &PodKiller{kclient: fkubernetes.NewSimpleClientset(), namespace: "pod-namespace", minAvailable: &minAvailable}
+			a, err := p.newAvailability(pods)
+			if err != nil {
+				t.Fatalf("Found unexpected error: %v", err)
+			}
+			var spared []string
+			for _, pod := range pods {
+				if a.check(pod) != "" {
+					spared = append(spared, pod.Name)
+					continue
+				}
+				a.record(pod)
+			}
+			if !reflect.DeepEqual(spared, test.spared) {
+				t.Errorf("Expected %v to be spared, but found %v", test.spared, spared)
+			}
+		})
+	}
+}
+
+func TestAvailabilityScale(t *testing.T) {
+	ten, four := int32(10), int32(4)
+	controller := true
+	clientset := fkubernetes.NewSimpleClientset(
+		&extensionsobj.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "pod-namespace", UID: "cerium"},
+			Spec:       extensionsobj.DeploymentSpec{Replicas: &ten},
+		},
+		&extensionsobj.ReplicaSet{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            "cerium-1234",
+				Namespace:       "pod-namespace",
+				OwnerReferences: []v1.OwnerReference{{Kind: "Deployment", Name: "cerium", UID: "cerium", Controller: &controller}},
+			},
+			Spec: extensionsobj.ReplicaSetSpec{Replicas: &ten},
+		},
+		&extensionsobj.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "erbium", Namespace: "pod-namespace", UID: "erbium"},
+			Spec:       extensionsobj.DeploymentSpec{Replicas: &four},
+		},
+		&extensionsobj.ReplicaSet{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            "erbium-old",
+				Namespace:       "pod-namespace",
+				OwnerReferences: []v1.OwnerReference{{Kind: "Deployment", Name: "erbium", UID: "erbium", Controller: &controller}},
+			},
+		},
+		&extensionsobj.ReplicaSet{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            "erbium-new",
+				Namespace:       "pod-namespace",
+				OwnerReferences: []v1.OwnerReference{{Kind: "Deployment", Name: "erbium", UID: "erbium", Controller: &controller}},
+			},
+		},
+	)
+	tests := map[string]struct {
+		pods         []v1.Pod
+		minAvailable intstr.IntOrString
+		spared       []string
+	}{
+		// Only 4 of the 10 replicas exist, so 50% requires all of them.
+		"FewerPodsThanReplicas": {
+			[]v1.Pod{
+				ownedPod("cerium-1", "cerium-1234", true),
+				ownedPod("cerium-2", "cerium-1234", true),
+				ownedPod("cerium-3", "cerium-1234", true),
+				ownedPod("cerium-4", "cerium-1234", true),
+			},
+			intstr.FromString("50%"),
+			[]string{"cerium-1", "cerium-2", "cerium-3", "cerium-4"},
+		},
+		// During a rollout, the ReplicaSets of a Deployment share its minimum.
+		"Rollout": {
+			[]v1.Pod{
+				ownedPod("erbium-1", "erbium-old", true),
+				ownedPod("erbium-2", "erbium-old", true),
+				ownedPod("erbium-3", "erbium-new", true),
+				ownedPod("erbium-4", "erbium-new", true),
+			},
+			intstr.FromInt(3),
+			[]string{"erbium-2", "erbium-3", "erbium-4"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			minAvailable := test.minAvailable
+			p := &PodKiller{kclient: clientset, namespace: "pod-namespace", minAvailable: &minAvailable}
+			a, err := p.newAvailability(test.pods)
+			if err != nil {
+				t.Fatalf("Found unexpected error: %v", err)
+			}
+			var spared []string
+			for _, pod := range test.pods {
+				if a.check(pod) != "" {
+					spared = append(spared, pod.Name)
+					continue
+				}
+				a.record(pod)
+			}
+			if !reflect.DeepEqual(spared, test.spared) {
+				t.Errorf("Expected %v to be spared, but found %v", test.spared, spared)
+			}
+		})
+	}
+}
+
+func TestKillPodsMinAvailable(t *testing.T) {
+	objects := []runtime.Object{&v1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "pod-namespace"}}}
+	for _, name := range []string{"cerium-1", "cerium-2", "cerium-3"} {
+		pod := ownedPod(name, "cerium", true)
+		objects = append(objects, &pod)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	minAvailable := intstr.FromInt(2)
+
+	p := &PodKiller{
+		kclient:      clientset,
+		namespace:    "pod-namespace",
+		killCount:    3,
+		minAvailable: &minAvailable,
+	}
+	p.killPods()
+	p.killPods()
+	pods, err := clientset.Core().Pods("pod-namespace").List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("Found unexpected error when listing pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Expected 2 pods to be kept available, but found %v", len(pods.Items))
+	}
+}
+
+func TestParseMinAvailable(t *testing.T) {
+	tests := map[string]bool{
+		"2":    true,
+		"0":    true,
+		"50%":  true,
+		"100%": true,
+		"-1":   false,
+		"101%": false,
+		"half": false,
+		"":     false,
+	}
+	for value, valid := range tests {
+		if _, err := spec.ParseMinAvailable(value); (err == nil) != valid {
+			t.Errorf("Expected %q to be valid: %v, but found error %v", value, valid, err)
+		}
+	}
+}
+
+// ownedPod returns a pod owned by the ReplicaSet with the given name.
+func ownedPod(name, owner string, ready bool) v1.Pod {
+	controller := true
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return v1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: "pod-namespace",
+			OwnerReferences: []v1.OwnerReference{
+				{Kind: "ReplicaSet", Name: owner, UID: types.UID(owner), Controller: &controller},
+			},
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package podkiller
+
+import (
+	"github.com/puppetlabs/fault-injector-controller/pkg/pods"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+const metricsNamespace = "faultinjector"
+const metricsSubsystem = "podkiller"
+
+// Results of an attempt to kill a pod.
+const (
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultRefused   = "refused"
+	resultDenied    = "denied"
+)
+
+var (
+	killAttemptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "kill_attempts_total",
+		Help:      "Number of attempts to kill a pod, by result. Refused attempts were evictions denied by a disruption budget, and denied attempts were denied by the fault budget.",
+	}, []string{"result"})
+	candidatesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "candidates",
+		Help:      "Number of pods considered for killing in the latest round.",
+	})
+	skippedRoundsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "skipped_rounds_total",
+		Help:      "Number of rounds skipped without killing any pod, by reason.",
+	}, []string{"reason"})
+	sparedVictimsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "spared_victims_total",
+		Help:      "Number of pods not killed because their controller would have dropped below the minimum availability.",
+	})
+	victimsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "victims_total",
+		Help:      "Number of pods killed, by namespace and the kind of their controller.",
+	}, []string{"namespace", "owner_kind"})
+)
+
+func init() {
+	prometheus.MustRegister(killAttemptsTotal)
+	prometheus.MustRegister(candidatesGauge)
+	prometheus.MustRegister(skippedRoundsTotal)
+	prometheus.MustRegister(sparedVictimsTotal)
+	prometheus.MustRegister(victimsTotal)
+}
+
+// ownerKind returns the kind of the controller owning a pod, or "None" for a
+// pod with no controller.
+func ownerKind(pod v1.Pod) string {
+	if owner := pods.ControllerOf(pod.ObjectMeta); owner != nil {
+		return owner.Kind
+	}
+	return "None"
+}
@@ -0,0 +1,27 @@
+package podkiller
+
+import (
+	"testing"
+
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestOwnerKind(t *testing.T) {
+	isController := true
+	tests := map[string]struct {
+		owners   []v1.OwnerReference
+		expected string
+	}{
+		"None":       {nil, "None"},
+		"Owner":      {[]v1.OwnerReference{{Kind: "Job", Name: "backup"}}, "None"},
+		"Controller": {[]v1.OwnerReference{{Kind: "Job", Name: "backup"}, {Kind: "ReplicaSet", Name: "checkout", Controller: &isController}}, "ReplicaSet"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pod := v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "hydrogen", OwnerReferences: test.owners}}
+			if kind := ownerKind(pod); kind != test.expected {
+				t.Errorf("Expected owner kind %v, but got %v", test.expected, kind)
+			}
+		})
+	}
+}
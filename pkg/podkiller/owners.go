@@ -0,0 +1,144 @@
+package podkiller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	"k8s.io/client-go/1.5/pkg/api"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/runtime/serializer"
+	"k8s.io/client-go/1.5/rest"
+)
+
+// statefulSetGroupVersion is the API group version serving StatefulSets. The
+// clientset only knows them as apps/v1alpha1 PetSets, which clusters no
+// longer serve.
+var statefulSetGroupVersion = unversioned.GroupVersion{Group: "apps", Version: "v1beta1"}
+
+// newStatefulSetClient creates a client for StatefulSets from a Kubernetes
+// client config.
+func newStatefulSetClient(cfg rest.Config) (*rest.RESTClient, error) {
+	cfg.APIPath = "/apis"
+	cfg.GroupVersion = &statefulSetGroupVersion
+	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: api.Codecs}
+	return rest.RESTClientFor(&cfg)
+}
+
+// annotateOwners records a fault against a pod on every controller which
+// owns it, walking up the chain of owner references (e.g. from a ReplicaSet
+// to its Deployment), so that the fault's provenance survives the pod.
+func (p *PodKiller) annotateOwners(pod v1.Pod) {
+	record := spec.FaultRecord{
+		Time:          unversioned.Now(),
+		FaultInjector: p.name,
+		Pod:           pod.Name,
+		Method:        p.methodName(),
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error when encoding fault record for pod %v: %v\n", pod.Name, err)
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				spec.LastFaultAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error when encoding fault record for pod %v: %v\n", pod.Name, err)
+		return
+	}
+
+	visited := make(map[string]bool)
+	owners := pod.ObjectMeta.OwnerReferences
+	for len(owners) > 0 {
+		owner := owners[0]
+		owners = owners[1:]
+		key := owner.Kind + "/" + owner.Name
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		ownerMeta, err := p.patchOwner(owner, patch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error when annotating %v %v with fault on pod %v: %v\n", owner.Kind, owner.Name, pod.Name, err)
+			continue
+		}
+		if ownerMeta != nil {
+			owners = append(owners, ownerMeta.OwnerReferences...)
+		}
+	}
+}
+
+// patchOwner applies a merge patch to the object referred to by an owner
+// reference, and returns the patched object's metadata. Owners of kinds that
+// are not known to the PodKiller are skipped.
+func (p *PodKiller) patchOwner(owner v1.OwnerReference, patch []byte) (*v1.ObjectMeta, error) {
+	switch owner.Kind {
+	case "ReplicaSet":
+		obj, err := p.kclient.Extensions().ReplicaSets(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "Deployment":
+		obj, err := p.kclient.Extensions().Deployments(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "DaemonSet":
+		obj, err := p.kclient.Extensions().DaemonSets(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "StatefulSet":
+		if p.statefulSets == nil {
+			return nil, nil
+		}
+		b, err := p.statefulSets.Patch(api.MergePatchType).
+			Namespace(p.namespace).
+			Resource("statefulsets").
+			Name(owner.Name).
+			Body(patch).
+			DoRaw()
+		if err != nil {
+			return nil, err
+		}
+		var obj struct {
+			ObjectMeta v1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "PetSet":
+		obj, err := p.kclient.Apps().PetSets(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "Job":
+		obj, err := p.kclient.Batch().Jobs(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	case "ReplicationController":
+		obj, err := p.kclient.Core().ReplicationControllers(p.namespace).Patch(owner.Name, api.MergePatchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return &obj.ObjectMeta, nil
+	default:
+		return nil, nil
+	}
+}
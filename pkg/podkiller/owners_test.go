@@ -0,0 +1,179 @@
+package podkiller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
+	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
+	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	extensionsobj "k8s.io/client-go/1.5/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	"k8s.io/client-go/1.5/rest"
+	ktesting "k8s.io/client-go/1.5/testing"
+)
+
+// TestAnnotateOwners tests that PodKiller.annotateOwners() annotates every controller up the chain of owner references.
+func TestAnnotateOwners(t *testing.T) {
+	owners := map[string]runtime.Object{
+		"replicasets": &extensionsobj.ReplicaSet{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            "checkout-1234",
+				Namespace:       "pod-namespace",
+				OwnerReferences: []v1.OwnerReference{{Kind: "Deployment", Name: "checkout"}},
+			},
+		},
+		"deployments": &extensionsobj.Deployment{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      "checkout",
+				Namespace: "pod-namespace",
+			},
+		},
+	}
+	patched := make(map[string][]byte)
+	clientset := fkubernetes.NewSimpleClientset()
+	clientset.PrependReactor("patch", "*", func(action ktesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(ktesting.PatchActionImpl)
+		patched[action.GetResource().Resource+"/"+patchAction.GetName()] = patchAction.GetPatch()
+		return true, owners[action.GetResource().Resource], nil
+	})
+
+	p := &PodKiller{
+		kclient:   clientset,
+		name:      "lanthanides",
+		namespace: "pod-namespace",
+		method:    spec.KillMethodEvict,
+	}
+	p.annotateOwners(v1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "checkout-1234-abcde",
+			Namespace: "pod-namespace",
+			OwnerReferences: []v1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "checkout-1234"},
+				{Kind: "Unknown", Name: "unknown"},
+			},
+		},
+	})
+
+	if len(patched) != 2 {
+		t.Errorf("Expected 2 owners to be annotated, but found %v: %v", len(patched), patched)
+	}
+	for _, key := range []string{"replicasets/checkout-1234", "deployments/checkout"} {
+		patch, ok := patched[key]
+		if !ok {
+			t.Errorf("Expected %v to be annotated, but it was not", key)
+			continue
+		}
+		var decoded struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(patch, &decoded); err != nil {
+			t.Errorf("Found unexpected error when decoding patch for %v: %v", key, err)
+			continue
+		}
+		var record spec.FaultRecord
+		if err := json.Unmarshal([]byte(decoded.Metadata.Annotations[spec.LastFaultAnnotation]), &record); err != nil {
+			t.Errorf("Found unexpected error when decoding fault record for %v: %v", key, err)
+			continue
+		}
+		if record.FaultInjector != "lanthanides" || record.Pod != "checkout-1234-abcde" || record.Method != spec.KillMethodEvict || record.Time.IsZero() {
+			t.Errorf("Found unexpected fault record for %v: %#v", key, record)
+		}
+	}
+}
+
+// TestKillPodsAnnotateOwners tests that PodKiller.killPods() annotates the owners of a pod only once it was killed.
+func TestKillPodsAnnotateOwners(t *testing.T) {
+	for name, refused := range map[string]bool{"Killed": false, "Refused": true} {
+		t.Run(name, func(t *testing.T) {
+			pod := ownedPod("cerium-1", "cerium", true)
+			clientset := fkubernetes.NewSimpleClientset(&pod)
+			clientset.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if refused {
+					return true, nil, apierrors.NewGenericServerResponse(apierrors.StatusTooManyRequests, "create", unversioned.GroupResource{Resource: "pods"}, "", "Cannot evict pod as it would violate the pod's disruption budget.", 0, false)
+				}
+				return true, nil, nil
+			})
+			patches := 0
+			clientset.PrependReactor("patch", "replicasets", func(action ktesting.Action) (bool, runtime.Object, error) {
+				patches++
+				return true, &extensionsobj.ReplicaSet{ObjectMeta: v1.ObjectMeta{Name: "cerium", Namespace: "pod-namespace"}}, nil
+			})
+			p := &PodKiller{
+				kclient:   clientset,
+				namespace: "pod-namespace",
+				killCount: 1,
+				method:    spec.KillMethodEvict,
+			}
+			p.killPods()
+			if expected := map[bool]int{false: 1, true: 0}[refused]; patches != expected {
+				t.Errorf("Expected %v owners to be annotated, but found %v", expected, patches)
+			}
+		})
+	}
+}
+
+// TestAnnotateOwnersStatefulSet tests that PodKiller.annotateOwners() patches StatefulSets through the apps/v1beta1 API.
+func TestAnnotateOwnersStatefulSet(t *testing.T) {
+	path := "/apis/apps/v1beta1/namespaces/pod-namespace/statefulsets/cassandra"
+	var patch []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != path {
+			t.Errorf("Expected PATCH %v, but found %v %v", path, r.Method, r.URL.Path)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != string(api.MergePatchType) {
+			t.Errorf("Expected a merge patch, but found content type %v", contentType)
+		}
+		var err error
+		if patch, err = ioutil.ReadAll(r.Body); err != nil {
+			t.Fatalf("Found unexpected error when reading request: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": v1.ObjectMeta{Name: "cassandra", Namespace: "pod-namespace"},
+		})
+	}))
+	defer server.Close()
+
+	statefulSets, err := newStatefulSetClient(rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Found unexpected error when creating client: %v", err)
+	}
+	p := &PodKiller{
+		kclient:      fkubernetes.NewSimpleClientset(),
+		statefulSets: statefulSets,
+		name:         "lanthanides",
+		namespace:    "pod-namespace",
+	}
+	p.annotateOwners(v1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "cassandra-0",
+			Namespace:       "pod-namespace",
+			OwnerReferences: []v1.OwnerReference{{Kind: "StatefulSet", Name: "cassandra"}},
+		},
+	})
+
+	var decoded struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		t.Fatalf("Found unexpected error when decoding patch: %v", err)
+	}
+	var record spec.FaultRecord
+	if err := json.Unmarshal([]byte(decoded.Metadata.Annotations[spec.LastFaultAnnotation]), &record); err != nil {
+		t.Fatalf("Found unexpected error when decoding fault record: %v", err)
+	}
+	if record.FaultInjector != "lanthanides" || record.Pod != "cassandra-0" {
+		t.Errorf("Found unexpected fault record: %#v", record)
+	}
+}
@@ -2,28 +2,84 @@ package podkiller
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/puppetlabs/fault-injector-controller/pkg/budget"
+	"github.com/puppetlabs/fault-injector-controller/pkg/client"
+	"github.com/puppetlabs/fault-injector-controller/pkg/schedule"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+	"github.com/puppetlabs/fault-injector-controller/version"
+
 	"k8s.io/client-go/1.5/kubernetes"
+	v1core "k8s.io/client-go/1.5/kubernetes/typed/core/v1"
 	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+	policy "k8s.io/client-go/1.5/pkg/apis/policy/v1alpha1"
+	"k8s.io/client-go/1.5/pkg/fields"
+	"k8s.io/client-go/1.5/pkg/labels"
+	"k8s.io/client-go/1.5/pkg/runtime"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
 	"k8s.io/client-go/1.5/pkg/util/wait"
 	"k8s.io/client-go/1.5/rest"
+	"k8s.io/client-go/1.5/tools/record"
 )
 
+// statusUpdateRetries is the number of times a status update is attempted
+// when it conflicts with a concurrent update, e.g. by the controller.
+const statusUpdateRetries = 3
+
 // PodKiller deletes Pods from Kubernetes.
 type PodKiller struct {
-	kclient   kubernetes.Interface
-	namespace string
+	kclient        kubernetes.Interface
+	statefulSets   *rest.RESTClient
+	faultInjectors client.Interface
+	name           string
+	namespace      string
+	labelSelector  labels.Selector
+	fieldSelector  fields.Selector
+	jitter         time.Duration
+	killCount      int
+	killPercent    int
+	optIn          bool
+	method         spec.KillMethod
+	gracePeriod    *int64
+	dryRun         bool
+	schedule       *schedule.Schedule
+	budget         *budget.Budget
+	minAvailable   *intstr.IntOrString
+	recorder       record.EventRecorder
+	// running is set atomically to 1 while Run is running.
+	running int32
 }
 
 // Config holds configuration parameters for a PodKiller.
 type Config struct {
-	Namespace   string
-	Host        string
-	TLSInsecure bool
-	TLSConfig   rest.TLSClientConfig
+	Name               string
+	Namespace          string
+	LabelSelector      string
+	FieldSelector      string
+	Jitter             time.Duration
+	KillCount          int
+	KillPercent        int
+	OptIn              bool
+	Method             spec.KillMethod
+	GracePeriodSeconds *int64
+	DryRun             bool
+	Schedule           *spec.FaultInjectorSchedule
+	BudgetNamespace    string
+	MinAvailable       *intstr.IntOrString
+	Host               string
+	TLSInsecure        bool
+	TLSConfig          rest.TLSClientConfig
 }
 
 // New creates a new PodKiller.
@@ -31,6 +87,25 @@ func New(conf Config) (*PodKiller, error) {
 	var cfg *rest.Config
 	var err error
 
+	if conf.KillCount < 0 {
+		return nil, fmt.Errorf("Kill count must not be negative, but got %v", conf.KillCount)
+	}
+	if conf.KillPercent < 0 || conf.KillPercent > 100 {
+		return nil, fmt.Errorf("Kill percent must be between 0 and 100, but got %v", conf.KillPercent)
+	}
+	if conf.KillCount > 0 && conf.KillPercent > 0 {
+		return nil, fmt.Errorf("Kill count and kill percent are mutually exclusive")
+	}
+	if !conf.Method.IsValid() {
+		return nil, fmt.Errorf("Unsupported kill method %v", conf.Method)
+	}
+	if conf.GracePeriodSeconds != nil && *conf.GracePeriodSeconds < 0 {
+		return nil, fmt.Errorf("Grace period must not be negative, but got %v", *conf.GracePeriodSeconds)
+	}
+	if conf.MinAvailable != nil && !spec.IsValidMinAvailable(*conf.MinAvailable) {
+		return nil, fmt.Errorf("Minimum availability must be a non-negative number or a percentage between 0%% and 100%%, but got %v", conf.MinAvailable.String())
+	}
+
 	if len(conf.Host) == 0 {
 		cfg, err = rest.InClusterConfig()
 		if err != nil {
@@ -50,27 +125,368 @@ func New(conf Config) (*PodKiller, error) {
 		}
 	}
 
+	faultInjectors, err := client.New(*cfg)
+	if err != nil {
+		return nil, err
+	}
 	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
+	statefulSets, err := newStatefulSetClient(*cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	labelSelector, err := labels.Parse(conf.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing label selector %s: %v", conf.LabelSelector, err)
+	}
+	fieldSelector, err := fields.ParseSelector(conf.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing field selector %s: %v", conf.FieldSelector, err)
+	}
+	var sched *schedule.Schedule
+	if conf.Schedule != nil {
+		sched, err = schedule.New(*conf.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing schedule: %v", err)
+		}
+	}
+
+	var b *budget.Budget
+	if conf.BudgetNamespace != "" {
+		b = budget.New(client, conf.BudgetNamespace)
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.Core().Events("")})
+	recorder := eventBroadcaster.NewRecorder(v1.EventSource{Component: "fault-injector-podkiller"})
 
 	return &PodKiller{
-		kclient:   client,
-		namespace: conf.Namespace,
+		kclient:        client,
+		statefulSets:   statefulSets,
+		faultInjectors: faultInjectors,
+		name:           conf.Name,
+		namespace:      conf.Namespace,
+		labelSelector:  labelSelector,
+		fieldSelector:  fieldSelector,
+		jitter:         conf.Jitter,
+		killCount:      conf.KillCount,
+		killPercent:    conf.KillPercent,
+		optIn:          conf.OptIn,
+		method:         conf.Method,
+		gracePeriod:    conf.GracePeriodSeconds,
+		dryRun:         conf.DryRun,
+		schedule:       sched,
+		budget:         b,
+		minAvailable:   conf.MinAvailable,
+		recorder:       recorder,
 	}, nil
 }
 
-// Run starts the PodKiller service.
+// Run starts the PodKiller service. Pods are killed once per interval, with
+// each wait extended by a random duration of up to the configured jitter.
+// Once stopChan is closed, Run returns after the current round has finished.
 func (p *PodKiller) Run(interval time.Duration, stopChan <-chan struct{}) error {
-	wait.Until(p.killPods, interval, stopChan)
+	atomic.StoreInt32(&p.running, 1)
+	defer atomic.StoreInt32(&p.running, 0)
+	var jitterFactor float64
+	if interval > 0 {
+		jitterFactor = float64(p.jitter) / float64(interval)
+	}
+	wait.JitterUntil(p.killPods, interval, jitterFactor, true, stopChan)
 	return nil
 }
 
+// Ready returns whether the PodKiller is running.
+func (p *PodKiller) Ready() bool {
+	return atomic.LoadInt32(&p.running) == 1
+}
+
 func (p *PodKiller) killPods() {
-	allPods, err := p.kclient.Core().Pods(p.namespace).List(api.ListOptions{})
-	if err == nil && len(allPods.Items) > 0 {
-		podToKill := allPods.Items[rand.Intn(len(allPods.Items))]
-		p.kclient.Core().Pods(p.namespace).Delete(podToKill.Name, &api.DeleteOptions{})
+	if p.schedule != nil && !p.schedule.Active(time.Now()) {
+		fmt.Printf("Outside the schedule, skipping this round\n")
+		skippedRoundsTotal.WithLabelValues("schedule").Inc()
+		return
+	}
+	listOptions := api.ListOptions{
+		LabelSelector: p.labelSelector,
+		FieldSelector: p.fieldSelector,
+	}
+	allPods, err := p.kclient.Core().Pods(p.namespace).List(listOptions)
+	if err != nil {
+		return
+	}
+	namespaceOptedIn := false
+	if p.optIn {
+		namespace, err := p.kclient.Core().Namespaces().Get(p.namespace)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error when checking whether namespace %v has opted in: %v\n", p.namespace, err)
+			return
+		}
+		namespaceOptedIn = spec.IsOptedIn(namespace.ObjectMeta)
+	}
+	candidates, filtered := p.filterCandidates(allPods.Items, namespaceOptedIn)
+	candidatesGauge.Set(float64(len(candidates)))
+	if len(filtered) > 0 {
+		fmt.Printf("Filtered out %v of %v pods: %v\n", len(allPods.Items)-len(candidates), len(allPods.Items), formatFilterReasons(filtered))
+	}
+	if len(candidates) > 0 {
+		var guard *availability
+		if p.minAvailable != nil {
+			namespacePods, err := p.listNamespacePods()
+			if err == nil {
+				guard, err = p.newAvailability(namespacePods)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error when checking the availability of pods in namespace %v, skipping this round: %v\n", p.namespace, err)
+				return
+			}
+		}
+		killed, denied := 0, 0
+		defer func() { p.recordFaults(killed, denied) }()
+		// Sample without replacement so that no pod is picked twice in a round.
+		// Victims which the availability guard spares are replaced by the next
+		// candidate.
+		remaining := p.victimCount(len(candidates))
+		for _, i := range rand.Perm(len(candidates)) {
+			if remaining == 0 {
+				break
+			}
+			podToKill := candidates[i]
+			if guard != nil {
+				if reason := guard.check(podToKill); reason != "" {
+					sparedVictimsTotal.Inc()
+					fmt.Printf("Sparing pod %v to keep its controller available: %v\n", podToKill.Name, reason)
+					continue
+				}
+				guard.record(podToKill)
+			}
+			remaining--
+			if p.dryRun {
+				fmt.Printf("Dry run: would have killed pod %v\n", podToKill.Name)
+				p.recordEvent(&podToKill, v1.EventTypeNormal, "DryRun",
+					fmt.Sprintf("FaultInjector %v would have killed this pod with method %v", p.name, p.methodName()))
+				p.recordFaultInjectorEvent(v1.EventTypeNormal, "DryRun",
+					fmt.Sprintf("FaultInjector %v would have killed pod %v with method %v", p.name, podToKill.Name, p.methodName()))
+				continue
+			}
+			fault, err := p.acquireBudget(podToKill)
+			if budget.IsDenied(err) {
+				denied++
+				killAttemptsTotal.WithLabelValues(resultDenied).Inc()
+				fmt.Printf("Killing pod %v was denied by the budget, skipping this round: %v\n", podToKill.Name, err)
+				p.recordFaultInjectorEvent(v1.EventTypeWarning, "FaultDenied",
+					fmt.Sprintf("FaultInjector %v was not allowed to kill pod %v: %v", p.name, podToKill.Name, err))
+				return
+			} else if err != nil {
+				killAttemptsTotal.WithLabelValues(resultFailed).Inc()
+				fmt.Fprintf(os.Stderr, "Error when checking the budget for pod %v, skipping this round: %v\n", podToKill.Name, err)
+				return
+			}
+			err = p.killPod(podToKill)
+			if err != nil {
+				p.releaseBudget(fault)
+			}
+			if isTooManyRequests(err) {
+				killAttemptsTotal.WithLabelValues(resultRefused).Inc()
+				fmt.Printf("Eviction of pod %v was refused by a disruption budget, skipping this round\n", podToKill.Name)
+				return
+			} else if err != nil {
+				killAttemptsTotal.WithLabelValues(resultFailed).Inc()
+				fmt.Fprintf(os.Stderr, "Error when killing pod %v: %v\n", podToKill.Name, err)
+				p.recordFaultInjectorEvent(v1.EventTypeWarning, "FaultInjectionFailed",
+					fmt.Sprintf("FaultInjector %v failed to kill pod %v with method %v: %v", p.name, podToKill.Name, p.methodName(), err))
+				continue
+			}
+			killed++
+			p.annotateOwners(podToKill)
+			killAttemptsTotal.WithLabelValues(resultSucceeded).Inc()
+			victimsTotal.WithLabelValues(p.namespace, ownerKind(podToKill)).Inc()
+			p.recordEvent(&podToKill, v1.EventTypeWarning, "FaultInjected",
+				fmt.Sprintf("FaultInjector %v killed this pod with method %v", p.name, p.methodName()))
+			p.recordFaultInjectorEvent(v1.EventTypeNormal, "FaultInjected",
+				fmt.Sprintf("FaultInjector %v killed pod %v with method %v", p.name, podToKill.Name, p.methodName()))
+		}
+	}
+}
+
+// acquireBudget records a fault on a pod against the budget, if one is
+// enforced, and returns the recorded fault. It returns an error for which
+// budget.IsDenied is true if the budget does not allow the fault.
+func (p *PodKiller) acquireBudget(pod v1.Pod) (budget.Fault, error) {
+	fault := budget.Fault{
+		Namespace:     p.namespace,
+		Pod:           pod.Name,
+		Owner:         budget.OwnerOf(pod),
+		FaultInjector: p.name,
+	}
+	if p.budget == nil {
+		return fault, nil
+	}
+	return p.budget.Acquire(fault)
+}
+
+// releaseBudget removes a fault which could not be injected from the budget,
+// if one is enforced.
+func (p *PodKiller) releaseBudget(fault budget.Fault) {
+	if p.budget == nil {
+		return
+	}
+	if err := p.budget.Release(fault); err != nil {
+		fmt.Fprintf(os.Stderr, "Error when releasing the budget for pod %v: %v\n", fault.Pod, err)
+	}
+}
+
+// recordFaults adds the given numbers of injected and denied faults to the
+// status of the FaultInjector on whose behalf the PodKiller is running, if its
+// name is known.
+func (p *PodKiller) recordFaults(count, denied int) {
+	if (count == 0 && denied == 0) || p.name == "" || p.faultInjectors == nil {
+		return
+	}
+	now := unversioned.Now()
+	for i := 0; i < statusUpdateRetries; i++ {
+		obj, err := p.faultInjectors.Get(p.namespace, p.name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error when recording faults in the status of FaultInjector %v: %v\n", p.name, err)
+			return
+		}
+		if count > 0 {
+			obj.Status.LastFaultTime = &now
+			obj.Status.TotalFaults += int64(count)
+		}
+		obj.Status.DeniedFaults += int64(denied)
+		_, err = p.faultInjectors.UpdateStatus(obj)
+		if !apierrors.IsConflict(err) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error when recording faults in the status of FaultInjector %v: %v\n", p.name, err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error when recording faults in the status of FaultInjector %v: gave up after %v conflicts\n", p.name, statusUpdateRetries)
+}
+
+// killPod kills a single pod using the configured method and grace period.
+func (p *PodKiller) killPod(pod v1.Pod) error {
+	gracePeriod := p.gracePeriod
+	if p.method == spec.KillMethodForceDelete {
+		gracePeriod = new(int64)
+	}
+	switch p.method {
+	case spec.KillMethodEvict:
+		return p.kclient.Core().Pods(p.namespace).Evict(&policy.Eviction{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: p.namespace,
+			},
+			DeleteOptions: &v1.DeleteOptions{GracePeriodSeconds: gracePeriod},
+		})
+	default:
+		return p.kclient.Core().Pods(p.namespace).Delete(pod.Name, &api.DeleteOptions{GracePeriodSeconds: gracePeriod})
+	}
+}
+
+// methodName returns the name of the configured kill method.
+func (p *PodKiller) methodName() spec.KillMethod {
+	if p.method == "" {
+		return spec.KillMethodDelete
+	}
+	return p.method
+}
+
+// faultInjectorReference returns a reference to the FaultInjector on whose
+// behalf the PodKiller is running.
+func (p *PodKiller) faultInjectorReference() *v1.ObjectReference {
+	return &v1.ObjectReference{
+		Kind:       spec.Kind,
+		APIVersion: spec.GroupName + "/" + version.ResourceAPIVersion,
+		Name:       p.name,
+		Namespace:  p.namespace,
+	}
+}
+
+// recordFaultInjectorEvent records a Kubernetes Event about the FaultInjector
+// on whose behalf the PodKiller is running, if its name is known.
+func (p *PodKiller) recordFaultInjectorEvent(eventType, reason, message string) {
+	if p.name != "" {
+		p.recordEvent(p.faultInjectorReference(), eventType, reason, message)
+	}
+}
+
+// recordEvent records a Kubernetes Event about an object, if the PodKiller
+// has an event recorder.
+func (p *PodKiller) recordEvent(object runtime.Object, eventType, reason, message string) {
+	if p.recorder != nil {
+		p.recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// isTooManyRequests returns whether an error is a 429 response, which the
+// Eviction API uses to signal that a PodDisruptionBudget would be violated.
+func isTooManyRequests(err error) bool {
+	if status, ok := err.(apierrors.APIStatus); ok {
+		return status.Status().Code == apierrors.StatusTooManyRequests
+	}
+	return false
+}
+
+// filterCandidates removes the pods which must never be killed from a list of
+// pods, and returns the remaining candidates along with the number of pods
+// removed for each reason. In opt-in mode, pods are only candidates if they or
+// their namespace have opted in.
+func (p *PodKiller) filterCandidates(pods []v1.Pod, namespaceOptedIn bool) ([]v1.Pod, map[string]int) {
+	var candidates []v1.Pod
+	filtered := make(map[string]int)
+	for _, pod := range pods {
+		switch {
+		case pod.ObjectMeta.Labels[spec.GeneratedByLabel] == spec.GeneratedByValue:
+			filtered["generated by FaultInjector"]++
+		case pod.ObjectMeta.Annotations[spec.ExemptAnnotation] == "true":
+			filtered["exempt by annotation"]++
+		case p.optIn && !namespaceOptedIn && !spec.IsOptedIn(pod.ObjectMeta):
+			filtered["not opted in"]++
+		default:
+			candidates = append(candidates, pod)
+		}
+	}
+	return candidates, filtered
+}
+
+// formatFilterReasons renders the counts returned by filterCandidates in a
+// stable order for logging.
+func formatFilterReasons(filtered map[string]int) string {
+	reasons := make([]string, 0, len(filtered))
+	for reason, count := range filtered {
+		reasons = append(reasons, fmt.Sprintf("%v %v", count, reason))
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, ", ")
+}
+
+// victimCount returns how many of the given number of candidate pods should
+// be killed in a single round. A percentage is rounded to the nearest pod,
+// but never down to zero pods, nor up to every pod unless 100% was requested.
+func (p *PodKiller) victimCount(candidates int) int {
+	var count int
+	switch {
+	case p.killPercent > 0:
+		count = int(math.Floor(float64(candidates*p.killPercent)/100.0 + 0.5))
+		if count < 1 {
+			count = 1
+		}
+		if p.killPercent < 100 && count >= candidates && candidates > 1 {
+			count = candidates - 1
+		}
+	case p.killCount > 0:
+		count = p.killCount
+	default:
+		count = 1
+	}
+	if count > candidates {
+		count = candidates
 	}
+	return count
 }
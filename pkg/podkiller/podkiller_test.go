@@ -3,16 +3,29 @@ package podkiller
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"math"
 
+	"github.com/puppetlabs/fault-injector-controller/pkg/budget"
+	ffaultinjectors "github.com/puppetlabs/fault-injector-controller/pkg/client/fake"
+	"github.com/puppetlabs/fault-injector-controller/pkg/schedule"
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+
 	"k8s.io/client-go/1.5/kubernetes"
 	fkubernetes "k8s.io/client-go/1.5/kubernetes/fake"
 	"k8s.io/client-go/1.5/pkg/api"
+	apierrors "k8s.io/client-go/1.5/pkg/api/errors"
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
 	"k8s.io/client-go/1.5/pkg/api/v1"
+	policy "k8s.io/client-go/1.5/pkg/apis/policy/v1alpha1"
+	"k8s.io/client-go/1.5/pkg/labels"
 	"k8s.io/client-go/1.5/pkg/runtime"
+	ktesting "k8s.io/client-go/1.5/testing"
+	"k8s.io/client-go/1.5/tools/record"
 )
 
 // TestRun tests the PodKiller.Run() method to validate that it kills pods periodically as expected.
@@ -47,6 +60,36 @@ func TestRun(t *testing.T) {
 	}
 }
 
+// TestRunJitter tests the PodKiller.Run() method to validate that jitter delays pod kills by no more than the jitter window.
+func TestRunJitter(t *testing.T) {
+	podCount := 8
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		namespace: "pod-namespace",
+		jitter:    time.Second,
+	}
+	stopChan := make(chan struct{})
+
+	// Kills happen at 0s, then every 1-2s, so 4.5s allows between 3 and 5 kills.
+	go p.Run(time.Second, stopChan)
+	time.Sleep(4500 * time.Millisecond)
+	close(stopChan)
+
+	namespacePods, err := clientset.Core().Pods("pod-namespace").List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("Found unexpected error when trying to list pods: %v\n", err)
+	}
+	if killed := podCount - len(namespacePods.Items); killed < 3 || killed > 5 {
+		t.Errorf("Expected between 3 and 5 pods to be killed with jitter, but found %v were killed\n", killed)
+	}
+}
+
 // TestKillPods tests the PodKiller.killPods() method to validate that it kills exactly one pod each time it is called.
 func TestKillPods(t *testing.T) {
 	podCount := 3
@@ -70,6 +113,544 @@ func TestKillPods(t *testing.T) {
 	}
 }
 
+// TestKillPodsLabelSelector tests that PodKiller.killPods() only kills pods matching its label selector.
+func TestKillPodsLabelSelector(t *testing.T) {
+	objects, err := generatePodList(4)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	for _, object := range objects {
+		if pod, ok := object.(*v1.Pod); ok && pod.ObjectMeta.Namespace == "pod-namespace" {
+			pod.ObjectMeta.Labels = map[string]string{"app": "checkout"}
+			if pod.ObjectMeta.Name == "lanthanum" || pod.ObjectMeta.Name == "cerium" {
+				pod.ObjectMeta.Labels["tier"] = "frontend"
+			}
+		}
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+
+	selector, err := labels.Parse("app=checkout,tier=frontend")
+	if err != nil {
+		t.Fatal("Error when parsing selector for test:", err)
+	}
+	p := &PodKiller{
+		kclient:       clientset,
+		namespace:     "pod-namespace",
+		labelSelector: selector,
+	}
+
+	for i := 0; i < 3; i++ {
+		p.killPods()
+	}
+	validatePodCount(t, clientset, 4, 2)
+	for _, name := range []string{"praseodymium", "neodymium"} {
+		if _, err := clientset.Core().Pods("pod-namespace").Get(name); err != nil {
+			t.Errorf("Expected pod %v not matching the selector to survive, but found error: %v", name, err)
+		}
+	}
+}
+
+// TestKillPodsCount tests that PodKiller.killPods() kills the configured number of pods each time it is called.
+func TestKillPodsCount(t *testing.T) {
+	podCount := 8
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		namespace: "pod-namespace",
+		killCount: 3,
+	}
+
+	for i := 0; i < 4; i++ {
+		t.Run(fmt.Sprintf("KillIteration-%v", i), func(t *testing.T) {
+			validatePodCount(t, clientset, podCount, i*3)
+		})
+		p.killPods()
+	}
+}
+
+// TestVictimCount tests the PodKiller.victimCount() method to validate how many pods are picked for each mode.
+func TestVictimCount(t *testing.T) {
+	for name, k := range map[string]struct {
+		killCount   int
+		killPercent int
+		candidates  int
+		expected    int
+	}{
+		"Default":                {0, 0, 10, 1},
+		"DefaultNoCandidates":    {0, 0, 0, 0},
+		"Count":                  {3, 0, 10, 3},
+		"CountAboveCandidates":   {3, 0, 2, 2},
+		"Percent":                {0, 30, 10, 3},
+		"PercentRounded":         {0, 30, 5, 2},
+		"PercentFloor":           {0, 10, 3, 1},
+		"PercentCeiling":         {0, 90, 3, 2},
+		"PercentSingleCandidate": {0, 50, 1, 1},
+		"PercentAll":             {0, 100, 7, 7},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &PodKiller{killCount: k.killCount, killPercent: k.killPercent}
+			if actual := p.victimCount(k.candidates); actual != k.expected {
+				t.Errorf("Expected %v victims out of %v candidates, but got %v", k.expected, k.candidates, actual)
+			}
+		})
+	}
+}
+
+// TestFilterCandidates tests that PodKiller.killPods() never kills exempt or FaultInjector pods, and that
+// PodKiller.filterCandidates() reports why each pod was filtered out.
+func TestFilterCandidates(t *testing.T) {
+	podCount := 5
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	for _, object := range objects {
+		if pod, ok := object.(*v1.Pod); ok {
+			switch pod.ObjectMeta.Name {
+			case "lanthanum", "cerium":
+				pod.ObjectMeta.Annotations = map[string]string{spec.ExemptAnnotation: "true"}
+			case "praseodymium":
+				pod.ObjectMeta.Annotations = map[string]string{spec.ExemptAnnotation: "false"}
+			case "neodymium":
+				pod.ObjectMeta.Labels = map[string]string{spec.GeneratedByLabel: spec.GeneratedByValue}
+			}
+		}
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		namespace: "pod-namespace",
+	}
+
+	pods, err := clientset.Core().Pods("pod-namespace").List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("Found unexpected error when trying to list pods: %v\n", err)
+	}
+	candidates, filtered := p.filterCandidates(pods.Items, false)
+	if len(candidates) != 2 {
+		t.Errorf("Expected 2 candidate pods, but found %v\n", len(candidates))
+	}
+	expectedFiltered := map[string]int{"exempt by annotation": 2, "generated by FaultInjector": 1}
+	if !reflect.DeepEqual(expectedFiltered, filtered) {
+		t.Errorf("Expected filtered pod counts %v, but found %v\n", expectedFiltered, filtered)
+	}
+
+	for i := 0; i < podCount; i++ {
+		p.killPods()
+	}
+	validatePodCount(t, clientset, podCount, 2)
+}
+
+// TestFilterCandidatesOptIn tests that in opt-in mode only pods which, or whose namespace, have opted in are killed.
+func TestFilterCandidatesOptIn(t *testing.T) {
+	podCount := 4
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	for _, object := range objects {
+		if pod, ok := object.(*v1.Pod); ok {
+			switch pod.ObjectMeta.Name {
+			case "lanthanum":
+				pod.ObjectMeta.Labels = map[string]string{spec.OptInMarker: "true"}
+			case "cerium":
+				pod.ObjectMeta.Annotations = map[string]string{spec.OptInMarker: "true"}
+			}
+		}
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		namespace: "pod-namespace",
+		optIn:     true,
+	}
+
+	pods, err := clientset.Core().Pods("pod-namespace").List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("Found unexpected error when trying to list pods: %v\n", err)
+	}
+	t.Run("PodOptIn", func(t *testing.T) {
+		candidates, filtered := p.filterCandidates(pods.Items, false)
+		if len(candidates) != 2 {
+			t.Errorf("Expected 2 candidate pods, but found %v\n", len(candidates))
+		}
+		expectedFiltered := map[string]int{"not opted in": 2}
+		if !reflect.DeepEqual(expectedFiltered, filtered) {
+			t.Errorf("Expected filtered pod counts %v, but found %v\n", expectedFiltered, filtered)
+		}
+	})
+	t.Run("NamespaceOptIn", func(t *testing.T) {
+		candidates, filtered := p.filterCandidates(pods.Items, true)
+		if len(candidates) != podCount {
+			t.Errorf("Expected %v candidate pods, but found %v\n", podCount, len(candidates))
+		}
+		if len(filtered) != 0 {
+			t.Errorf("Expected no pods to be filtered, but found %v\n", filtered)
+		}
+	})
+	t.Run("KillPods", func(t *testing.T) {
+		for i := 0; i < podCount; i++ {
+			p.killPods()
+		}
+		validatePodCount(t, clientset, podCount, 2)
+	})
+}
+
+// TestKillPodsMethod tests that PodKiller.killPods() kills pods using the configured method.
+func TestKillPodsMethod(t *testing.T) {
+	podCount := 4
+	for _, method := range []spec.KillMethod{spec.KillMethodDelete, spec.KillMethodForceDelete} {
+		t.Run(string(method), func(t *testing.T) {
+			objects, err := generatePodList(podCount)
+			if err != nil {
+				t.Fatal("Error when generating pods for test:", err)
+			}
+			clientset := fkubernetes.NewSimpleClientset(objects...)
+			p := &PodKiller{
+				kclient:   clientset,
+				namespace: "pod-namespace",
+				killCount: 2,
+				method:    method,
+			}
+			p.killPods()
+			validatePodCount(t, clientset, podCount, 2)
+		})
+	}
+
+	t.Run(string(spec.KillMethodEvict), func(t *testing.T) {
+		objects, err := generatePodList(podCount)
+		if err != nil {
+			t.Fatal("Error when generating pods for test:", err)
+		}
+		clientset := fkubernetes.NewSimpleClientset(objects...)
+		evictions := 0
+		clientset.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			evictions++
+			return true, nil, nil
+		})
+		p := &PodKiller{
+			kclient:   clientset,
+			namespace: "pod-namespace",
+			killCount: 2,
+			method:    spec.KillMethodEvict,
+		}
+		p.killPods()
+		if evictions != 2 {
+			t.Errorf("Expected 2 pods to be evicted, but found %v evictions", evictions)
+		}
+		validatePodCount(t, clientset, podCount, 0)
+	})
+
+	t.Run("EvictDisruptionBudget", func(t *testing.T) {
+		objects, err := generatePodList(podCount)
+		if err != nil {
+			t.Fatal("Error when generating pods for test:", err)
+		}
+		clientset := fkubernetes.NewSimpleClientset(objects...)
+		evictions := 0
+		clientset.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			evictions++
+			return true, nil, apierrors.NewGenericServerResponse(apierrors.StatusTooManyRequests, "create", unversioned.GroupResource{Resource: "pods"}, "", "Cannot evict pod as it would violate the pod's disruption budget.", 0, false)
+		})
+		p := &PodKiller{
+			kclient:   clientset,
+			namespace: "pod-namespace",
+			killCount: 3,
+			method:    spec.KillMethodEvict,
+		}
+		p.killPods()
+		if evictions != 1 {
+			t.Errorf("Expected the round to stop after 1 refused eviction, but found %v evictions", evictions)
+		}
+	})
+}
+
+// TestKillPodGracePeriod tests that PodKiller.killPod() passes the configured grace period to the API server.
+func TestKillPodGracePeriod(t *testing.T) {
+	zero := int64(0)
+	thirty := int64(30)
+	for name, k := range map[string]struct {
+		gracePeriod *int64
+		expected    *int64
+	}{
+		"Unset": {nil, nil},
+		"Zero":  {&zero, &zero},
+		"Set":   {&thirty, &thirty},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clientset := fkubernetes.NewSimpleClientset()
+			var actual *v1.DeleteOptions
+			clientset.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+				eviction := action.(ktesting.CreateAction).GetObject().(*policy.Eviction)
+				actual = eviction.DeleteOptions
+				return true, nil, nil
+			})
+			p := &PodKiller{
+				kclient:     clientset,
+				namespace:   "pod-namespace",
+				method:      spec.KillMethodEvict,
+				gracePeriod: k.gracePeriod,
+			}
+			if err := p.killPod(v1.Pod{ObjectMeta: v1.ObjectMeta{Name: "lanthanum", Namespace: "pod-namespace"}}); err != nil {
+				t.Fatalf("Found unexpected error when killing pod: %v", err)
+			}
+			if actual == nil {
+				t.Fatal("Expected eviction to carry DeleteOptions, but found none")
+			}
+			if !reflect.DeepEqual(k.expected, actual.GracePeriodSeconds) {
+				t.Errorf("Expected grace period %v, but found %v", k.expected, actual.GracePeriodSeconds)
+			}
+		})
+	}
+}
+
+// TestKillPodsDryRun tests that in dry-run mode PodKiller.killPods() records an event for each victim but kills nothing.
+func TestKillPodsDryRun(t *testing.T) {
+	podCount := 4
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	recorder := record.NewFakeRecorder(podCount)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		name:      "lanthanides",
+		namespace: "pod-namespace",
+		dryRun:    true,
+		recorder:  recorder,
+	}
+	p.killPods()
+	validatePodCount(t, clientset, podCount, 0)
+
+	validateEvents(t, recorder, []string{
+		"Normal DryRun FaultInjector lanthanides would have killed this pod with method delete",
+		"Normal DryRun FaultInjector lanthanides would have killed pod ",
+	})
+}
+
+// TestKillPodsSchedule tests that PodKiller.killPods() only kills pods while its schedule is active.
+func TestKillPodsSchedule(t *testing.T) {
+	tests := map[string]struct {
+		schedule spec.FaultInjectorSchedule
+		killed   int
+	}{
+		"Active":   {spec.FaultInjectorSchedule{Cron: "* * * * *"}, 1},
+		"Inactive": {spec.FaultInjectorSchedule{Cron: "0 0 30 2 *"}, 0},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			podCount := 3
+			objects, err := generatePodList(podCount)
+			if err != nil {
+				t.Fatal("Error when generating pods for test:", err)
+			}
+			clientset := fkubernetes.NewSimpleClientset(objects...)
+			sched, err := schedule.New(test.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := &PodKiller{
+				kclient:   clientset,
+				namespace: "pod-namespace",
+				schedule:  sched,
+			}
+			p.killPods()
+			validatePodCount(t, clientset, podCount, test.killed)
+		})
+	}
+}
+
+// TestKillPodsEvents tests that PodKiller.killPods() records an event on both the victim and the FaultInjector.
+func TestKillPodsEvents(t *testing.T) {
+	podCount := 2
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	recorder := record.NewFakeRecorder(podCount)
+
+	p := &PodKiller{
+		kclient:   clientset,
+		name:      "lanthanides",
+		namespace: "pod-namespace",
+		method:    spec.KillMethodForceDelete,
+		recorder:  recorder,
+	}
+	p.killPods()
+	validatePodCount(t, clientset, podCount, 1)
+
+	validateEvents(t, recorder, []string{
+		"Warning FaultInjected FaultInjector lanthanides killed this pod with method forceDelete",
+		"Normal FaultInjected FaultInjector lanthanides killed pod ",
+	})
+}
+
+func TestKillPodsStatus(t *testing.T) {
+	podCount := 4
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	faultInjectors := ffaultinjectors.New(&spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "lanthanides",
+			Namespace: "pod-namespace",
+		},
+		Status: spec.FaultInjectorStatus{
+			Phase:       spec.FaultInjectorRunning,
+			TotalFaults: 1,
+		},
+	})
+
+	p := &PodKiller{
+		kclient:        clientset,
+		faultInjectors: faultInjectors,
+		name:           "lanthanides",
+		namespace:      "pod-namespace",
+		killCount:      2,
+	}
+	p.killPods()
+	validatePodCount(t, clientset, podCount, 2)
+
+	obj, err := faultInjectors.Get("pod-namespace", "lanthanides")
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	if obj.Status.TotalFaults != 3 {
+		t.Errorf("Expected 3 total faults, but found %v", obj.Status.TotalFaults)
+	}
+	if obj.Status.LastFaultTime == nil {
+		t.Errorf("Expected the last fault time to be set")
+	}
+	if obj.Status.Phase != spec.FaultInjectorRunning {
+		t.Errorf("Expected the phase to be left as %v, but found %v", spec.FaultInjectorRunning, obj.Status.Phase)
+	}
+
+	p.dryRun = true
+	p.killPods()
+	obj, err = faultInjectors.Get("pod-namespace", "lanthanides")
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	if obj.Status.TotalFaults != 3 {
+		t.Errorf("Expected a dry run to leave 3 total faults, but found %v", obj.Status.TotalFaults)
+	}
+}
+
+func TestKillPodsBudget(t *testing.T) {
+	podCount := 4
+	objects, err := generatePodList(podCount)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	objects = append(objects, &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: budget.ConfigMap, Namespace: "budget-namespace"},
+		Data:       map[string]string{budget.MaxFaultsKey: "1", budget.WindowKey: "1h"},
+	})
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	faultInjectors := ffaultinjectors.New(&spec.FaultInjector{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "lanthanides",
+			Namespace: "pod-namespace",
+		},
+	})
+	recorder := record.NewFakeRecorder(podCount)
+
+	p := &PodKiller{
+		kclient:        clientset,
+		faultInjectors: faultInjectors,
+		name:           "lanthanides",
+		namespace:      "pod-namespace",
+		killCount:      3,
+		budget:         budget.New(clientset, "budget-namespace"),
+		recorder:       recorder,
+	}
+	p.killPods()
+	validatePodCount(t, clientset, podCount, 1)
+	validateEvents(t, recorder, []string{
+		"Warning FaultInjected FaultInjector lanthanides killed this pod",
+		"Normal FaultInjected FaultInjector lanthanides killed pod ",
+		"Warning FaultDenied FaultInjector lanthanides was not allowed to kill pod ",
+	})
+
+	obj, err := faultInjectors.Get("pod-namespace", "lanthanides")
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting FaultInjector: %v", err)
+	}
+	if obj.Status.TotalFaults != 1 || obj.Status.DeniedFaults != 1 {
+		t.Errorf("Expected 1 total fault and 1 denied fault, but found %v and %v", obj.Status.TotalFaults, obj.Status.DeniedFaults)
+	}
+}
+
+// TestKillPodsBudgetRelease tests that PodKiller.killPods() releases the budget of a pod it failed to kill.
+func TestKillPodsBudgetRelease(t *testing.T) {
+	objects, err := generatePodList(2)
+	if err != nil {
+		t.Fatal("Error when generating pods for test:", err)
+	}
+	objects = append(objects, &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: budget.ConfigMap, Namespace: "budget-namespace"},
+		Data:       map[string]string{budget.MaxFaultsKey: "1", budget.WindowKey: "1h"},
+	})
+	clientset := fkubernetes.NewSimpleClientset(objects...)
+	clientset.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewGenericServerResponse(apierrors.StatusTooManyRequests, "create", unversioned.GroupResource{Resource: "pods"}, "", "Cannot evict pod as it would violate the pod's disruption budget.", 0, false)
+	})
+
+	p := &PodKiller{
+		kclient:   clientset,
+		namespace: "pod-namespace",
+		killCount: 1,
+		method:    spec.KillMethodEvict,
+		budget:    budget.New(clientset, "budget-namespace"),
+	}
+	p.killPods()
+	cm, err := clientset.Core().ConfigMaps("budget-namespace").Get(budget.ConfigMap)
+	if err != nil {
+		t.Fatalf("Found unexpected error when getting ConfigMap: %v", err)
+	}
+	if ledger := cm.Data[budget.LedgerKey]; ledger != "[]" {
+		t.Errorf("Expected the refused eviction to be released from the ledger, but found %v", ledger)
+	}
+}
+
+// validateEvents checks that the events recorded by a FakeRecorder begin with each of the expected prefixes, in order.
+func validateEvents(t *testing.T, recorder *record.FakeRecorder, expected []string) {
+	for _, prefix := range expected {
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, prefix) {
+				t.Errorf("Expected event starting with %q, but found %q", prefix, event)
+			}
+		default:
+			t.Errorf("Expected event starting with %q, but found none", prefix)
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Found unexpected event %q", event)
+	default:
+	}
+}
+
 func validatePodCount(t *testing.T, clientset kubernetes.Interface, initialPodCount int, killInvocations int) {
 	expectedCount := int(math.Max(float64(initialPodCount-killInvocations), 0.0))
 	if namespacePods, err := clientset.Core().Pods("pod-namespace").List(api.ListOptions{}); err != nil {
@@ -0,0 +1,32 @@
+// Package pods holds the helpers with which the injectors and their guards
+// inspect pods, so that they all agree on which pods are available and which
+// controller owns them.
+package pods
+
+import (
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+// ControllerOf returns the reference to the controller owning an object, such
+// as a pod or a ReplicaSet, or nil for an object with no controller.
+func ControllerOf(meta v1.ObjectMeta) *v1.OwnerReference {
+	for i, owner := range meta.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller {
+			return &meta.OwnerReferences[i]
+		}
+	}
+	return nil
+}
+
+// IsAvailable returns whether a pod is ready and not terminating.
+func IsAvailable(pod v1.Pod) bool {
+	if pod.ObjectMeta.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
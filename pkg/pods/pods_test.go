@@ -0,0 +1,52 @@
+package pods
+
+import (
+	"testing"
+
+	"k8s.io/client-go/1.5/pkg/api/unversioned"
+	"k8s.io/client-go/1.5/pkg/api/v1"
+)
+
+func TestControllerOf(t *testing.T) {
+	isController := true
+	tests := map[string]struct {
+		owners   []v1.OwnerReference
+		expected string
+	}{
+		"None":       {nil, ""},
+		"Owner":      {[]v1.OwnerReference{{Kind: "Job", Name: "backup"}}, ""},
+		"Controller": {[]v1.OwnerReference{{Kind: "Job", Name: "backup"}, {Kind: "ReplicaSet", Name: "checkout", Controller: &isController}}, "checkout"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			owner := ControllerOf(v1.ObjectMeta{Name: "hydrogen", OwnerReferences: test.owners})
+			switch {
+			case test.expected == "" && owner != nil:
+				t.Errorf("Expected no controller, but found %v", owner.Name)
+			case test.expected != "" && (owner == nil || owner.Name != test.expected):
+				t.Errorf("Expected controller %v, but found %v", test.expected, owner)
+			}
+		})
+	}
+}
+
+func TestIsAvailable(t *testing.T) {
+	deleted := unversioned.Now()
+	ready := []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	tests := map[string]struct {
+		pod      v1.Pod
+		expected bool
+	}{
+		"Ready":       {v1.Pod{Status: v1.PodStatus{Conditions: ready}}, true},
+		"NotReady":    {v1.Pod{Status: v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}}}, false},
+		"NoCondition": {v1.Pod{}, false},
+		"Terminating": {v1.Pod{ObjectMeta: v1.ObjectMeta{DeletionTimestamp: &deleted}, Status: v1.PodStatus{Conditions: ready}}, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if available := IsAvailable(test.pod); available != test.expected {
+				t.Errorf("Expected available to be %v, but found %v", test.expected, available)
+			}
+		})
+	}
+}
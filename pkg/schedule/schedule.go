@@ -0,0 +1,162 @@
+// Package schedule evaluates the schedules which restrict when
+// FaultInjectors inject faults.
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+)
+
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// Schedule is a parsed spec.FaultInjectorSchedule.
+type Schedule struct {
+	location *time.Location
+	cron     *cron
+	windows  []window
+}
+
+// window is a parsed spec.ScheduleWindow. Start and end are minutes since
+// midnight.
+type window struct {
+	days       [7]bool
+	start, end int
+}
+
+// New parses and validates a FaultInjectorSchedule.
+func New(s spec.FaultInjectorSchedule) (*Schedule, error) {
+	if s.Cron == "" && len(s.Windows) == 0 {
+		return nil, fmt.Errorf("A schedule must have a cron expression or at least one window")
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown time zone %q: %v", s.TimeZone, err)
+	}
+	schedule := &Schedule{location: location}
+	if s.Cron != "" {
+		if schedule.cron, err = parseCron(s.Cron); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range s.Windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, parsed)
+	}
+	return schedule, nil
+}
+
+// Active returns whether rounds of fault injection may run at t.
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.location)
+	if s.cron != nil && s.cron.matches(t) {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// The window runs past midnight.
+		if w.days[today] && minute >= w.start || w.days[yesterday] && minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWindow(w spec.ScheduleWindow) (window, error) {
+	var parsed window
+	var err error
+	if parsed.start, err = parseTimeOfDay(w.Start); err != nil {
+		return parsed, err
+	}
+	if parsed.end, err = parseTimeOfDay(w.End); err != nil {
+		return parsed, err
+	}
+	if parsed.start == parsed.end {
+		return parsed, fmt.Errorf("Window %v starts and ends at the same time", FormatWindow(w))
+	}
+	if len(w.Days) == 0 {
+		for i := range parsed.days {
+			parsed.days[i] = true
+		}
+		return parsed, nil
+	}
+	for _, days := range w.Days {
+		bounds := strings.SplitN(days, "-", 2)
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return parsed, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseWeekday(bounds[1]); err != nil {
+				return parsed, err
+			}
+		}
+		// Ranges may wrap around the end of the week, e.g. "Sat-Sun".
+		for d := first; ; d = (d + 1) % 7 {
+			parsed.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return parsed, nil
+}
+
+func parseWeekday(name string) (int, error) {
+	for i, weekday := range weekdays {
+		if strings.EqualFold(name, weekday) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown day of the week %q: expected one of %v", name, strings.Join(weekdays, ", "))
+}
+
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time of day %q: expected a time such as 09:30", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// FormatWindow formats a ScheduleWindow as a string such as
+// "Mon-Fri 10:00-16:00", which ParseWindow parses.
+func FormatWindow(w spec.ScheduleWindow) string {
+	if len(w.Days) == 0 {
+		return w.Start + "-" + w.End
+	}
+	return strings.Join(w.Days, ",") + " " + w.Start + "-" + w.End
+}
+
+// ParseWindow parses a ScheduleWindow formatted by FormatWindow.
+func ParseWindow(value string) (spec.ScheduleWindow, error) {
+	var w spec.ScheduleWindow
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+	case 2:
+		w.Days = strings.Split(fields[0], ",")
+	default:
+		return w, fmt.Errorf("Invalid window %q: expected a window such as \"Mon-Fri 10:00-16:00\"", value)
+	}
+	times := strings.SplitN(fields[len(fields)-1], "-", 2)
+	if len(times) != 2 {
+		return w, fmt.Errorf("Invalid window %q: expected a window such as \"Mon-Fri 10:00-16:00\"", value)
+	}
+	w.Start, w.End = times[0], times[1]
+	return w, nil
+}
@@ -0,0 +1,120 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/fault-injector-controller/pkg/spec"
+)
+
+func TestNewInvalid(t *testing.T) {
+	tests := map[string]spec.FaultInjectorSchedule{
+		"Empty":            {},
+		"TimeZone":         {TimeZone: "Europe/Atlantis", Cron: "* * * * *"},
+		"CronFields":       {Cron: "* * * *"},
+		"CronRange":        {Cron: "0 24 * * *"},
+		"CronStep":         {Cron: "*/0 * * * *"},
+		"CronName":         {Cron: "* * * * Funday"},
+		"WindowTime":       {Windows: []spec.ScheduleWindow{{Start: "10am", End: "16:00"}}},
+		"WindowEmpty":      {Windows: []spec.ScheduleWindow{{Start: "10:00", End: "10:00"}}},
+		"WindowDays":       {Windows: []spec.ScheduleWindow{{Days: []string{"Mon-Funday"}, Start: "10:00", End: "16:00"}}},
+		"WindowMissingEnd": {Windows: []spec.ScheduleWindow{{Start: "10:00"}}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(test); err == nil {
+				t.Errorf("Expected an error for schedule %+v", test)
+			}
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2017-03-06 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2017, 3, 6+day, hour, minute, 0, 0, london)
+	}
+	tests := map[string]struct {
+		schedule spec.FaultInjectorSchedule
+		active   []time.Time
+		inactive []time.Time
+	}{
+		"BusinessHours": {
+			spec.FaultInjectorSchedule{
+				TimeZone: "Europe/London",
+				Windows:  []spec.ScheduleWindow{{Days: []string{"Mon-Fri"}, Start: "10:00", End: "16:00"}},
+			},
+			[]time.Time{at(0, 10, 0), at(4, 15, 59), time.Date(2017, 3, 6, 14, 0, 0, 0, time.UTC)},
+			[]time.Time{at(0, 9, 59), at(0, 16, 0), at(5, 12, 0), at(6, 12, 0)},
+		},
+		"Overnight": {
+			spec.FaultInjectorSchedule{
+				Windows: []spec.ScheduleWindow{{Days: []string{"Fri", "Sat-Sun"}, Start: "22:00", End: "02:00"}},
+			},
+			[]time.Time{at(4, 23, 0).UTC(), at(5, 1, 0).UTC(), at(7, 1, 59).UTC()},
+			[]time.Time{at(4, 21, 59).UTC(), at(4, 1, 0).UTC(), at(7, 22, 0).UTC()},
+		},
+		"Cron": {
+			spec.FaultInjectorSchedule{
+				TimeZone: "Europe/London",
+				Cron:     "*/15 10-15 * * mon-fri",
+			},
+			[]time.Time{at(0, 10, 0), at(0, 10, 45), at(4, 15, 30)},
+			[]time.Time{at(0, 10, 1), at(0, 16, 0), at(5, 12, 0)},
+		},
+		"CronDayOfMonthOrWeek": {
+			spec.FaultInjectorSchedule{
+				Cron: "0 12 1 * 0",
+			},
+			[]time.Time{time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2017, 3, 12, 12, 0, 0, 0, time.UTC)},
+			[]time.Time{time.Date(2017, 3, 2, 12, 0, 0, 0, time.UTC)},
+		},
+		"CronOrWindow": {
+			spec.FaultInjectorSchedule{
+				Cron:    "0 0 * * *",
+				Windows: []spec.ScheduleWindow{{Start: "12:00", End: "13:00"}},
+			},
+			[]time.Time{at(0, 0, 0).UTC(), at(3, 12, 30).UTC()},
+			[]time.Time{at(0, 0, 1).UTC(), at(3, 13, 0).UTC()},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(test.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, active := range test.active {
+				if !s.Active(active) {
+					t.Errorf("Expected the schedule to be active at %v", active)
+				}
+			}
+			for _, inactive := range test.inactive {
+				if s.Active(inactive) {
+					t.Errorf("Expected the schedule to be inactive at %v", inactive)
+				}
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, w := range []spec.ScheduleWindow{
+		{Start: "10:00", End: "16:00"},
+		{Days: []string{"Mon-Fri", "Sun"}, Start: "22:00", End: "02:00"},
+	} {
+		parsed, err := ParseWindow(FormatWindow(w))
+		if err != nil {
+			t.Errorf("Error when parsing window %v: %v", FormatWindow(w), err)
+		} else if FormatWindow(parsed) != FormatWindow(w) {
+			t.Errorf("Expected to parse window %v, but got %v", FormatWindow(w), FormatWindow(parsed))
+		}
+	}
+	if _, err := ParseWindow("Mon-Fri 10:00"); err == nil {
+		t.Errorf("Expected an error for a window without an end")
+	}
+}
@@ -0,0 +1,34 @@
+// Package server serves the metrics and health checks of the controller and
+// the injectors over HTTP.
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewHandler returns a handler serving Prometheus metrics at /metrics, a
+// liveness check at /healthz, and a readiness check at /readyz which succeeds
+// while ready returns true.
+func NewHandler(ready func() bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// ListenAndServe serves the handler returned by NewHandler on addr.
+func ListenAndServe(addr string, ready func() bool) error {
+	return http.ListenAndServe(addr, NewHandler(ready))
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHandler(t *testing.T) {
+	ready := false
+	server := httptest.NewServer(NewHandler(func() bool { return ready }))
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		ready    bool
+		expected int
+	}{
+		{"/healthz", false, http.StatusOK},
+		{"/readyz", false, http.StatusServiceUnavailable},
+		{"/readyz", true, http.StatusOK},
+		{"/metrics", false, http.StatusOK},
+	}
+	for _, test := range tests {
+		ready = test.ready
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expected {
+			t.Errorf("Expected %v (ready %v) to return %v, but got %v", test.path, test.ready, test.expected, resp.StatusCode)
+		}
+	}
+}
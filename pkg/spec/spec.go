@@ -1,15 +1,49 @@
 package spec
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"k8s.io/client-go/1.5/pkg/api/unversioned"
 	"k8s.io/client-go/1.5/pkg/api/v1"
+	"k8s.io/client-go/1.5/pkg/util/intstr"
+)
+
+const (
+	// GroupName is the API group of the FaultInjector resource.
+	GroupName = "k8s.puppet.com"
+	// Kind is the kind of the FaultInjector resource.
+	Kind = "FaultInjector"
+	// GeneratedByLabel is set on every object created on behalf of a
+	// FaultInjector, including the Pods running the injectors themselves.
+	GeneratedByLabel = "generatedBy"
+	// GeneratedByValue is the value of GeneratedByLabel for FaultInjector objects.
+	GeneratedByValue = "FaultInjector"
+	// ExemptAnnotation marks a Pod which must never be targeted by a
+	// FaultInjector when set to "true".
+	ExemptAnnotation = "faultinjector.k8s.puppet.com/exempt"
+	// OptInMarker marks a Pod or Namespace as eligible for fault injection
+	// by FaultInjectors running in opt-in mode when set to "true". It may be
+	// given either as a label or as an annotation.
+	OptInMarker = "faultinjector.k8s.puppet.com/opt-in"
+	// LastFaultAnnotation is set on the controllers owning a Pod killed by a
+	// FaultInjector, and holds a JSON-encoded FaultRecord.
+	LastFaultAnnotation = "faultinjector.k8s.puppet.com/last-fault"
+	// SpecHashAnnotation is set on the Deployment of a FaultInjector, and
+	// holds a hash of the FaultInjector it was generated from.
+	SpecHashAnnotation = "faultinjector.k8s.puppet.com/spec-hash"
+	// Finalizer is set on every FaultInjector by the controller, so that it
+	// can stop the injectors before the FaultInjector is deleted.
+	Finalizer = "faultinjector.k8s.puppet.com/teardown"
 )
 
 // FaultInjector defines a FaultInjector deployment.
 type FaultInjector struct {
 	unversioned.TypeMeta `json:",inline"`
 	v1.ObjectMeta        `json:"metadata,omitempty"`
-	Spec                 FaultInjectorSpec `json:"spec"`
+	Spec                 FaultInjectorSpec   `json:"spec"`
+	Status               FaultInjectorStatus `json:"status,omitempty"`
 }
 
 // FaultInjectorList is a list of FaultInjectors.
@@ -21,8 +55,231 @@ type FaultInjectorList struct {
 
 // FaultInjectorSpec holds specification parameters for a FaultInjector deployment.
 type FaultInjectorSpec struct {
-	Type FaultInjectorType `json:"type,omitempty"`
+	Type     FaultInjectorType     `json:"type,omitempty"`
+	Selector FaultInjectorSelector `json:"selector,omitempty"`
+	// Interval is the base period between fault injection rounds.
+	Interval unversioned.Duration `json:"interval,omitempty"`
+	// Jitter is the maximum random delay added to each Interval.
+	Jitter unversioned.Duration `json:"jitter,omitempty"`
+	// KillCount is the number of Pods to kill each round. Mutually exclusive
+	// with KillPercent; if neither is set, a single Pod is killed.
+	KillCount int32 `json:"killCount,omitempty"`
+	// KillPercent is the percentage of matching Pods to kill each round.
+	KillPercent int32 `json:"killPercent,omitempty"`
+	// OptIn restricts the FaultInjector to Pods which, or whose Namespace,
+	// carry the OptInMarker.
+	OptIn bool `json:"optIn,omitempty"`
+	// Method is the manner in which Pods are killed. Defaults to KillMethodDelete.
+	Method KillMethod `json:"method,omitempty"`
+	// GracePeriodSeconds overrides the termination grace period of killed
+	// Pods. Zero kills Pods immediately; if unset, each Pod's own
+	// terminationGracePeriodSeconds is used.
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	// MinAvailable is the number or percentage of the pods of each
+	// controller, e.g. a ReplicaSet, which must stay ready. Pods whose
+	// killing would leave fewer ready pods are spared. If unset, any pod may
+	// be killed.
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// DryRun makes the FaultInjector report the faults it would have
+	// injected, without injecting them.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Paused stops the injectors of the FaultInjector until it is unset,
+	// keeping the FaultInjector and its status.
+	Paused bool `json:"paused,omitempty"`
+	// Schedule restricts fault injection to certain times. If unset, faults
+	// are injected at any time.
+	Schedule *FaultInjectorSchedule `json:"schedule,omitempty"`
+	// StartTime is the time the FaultInjector starts injecting faults. If
+	// unset, it starts as soon as it is created.
+	StartTime *unversioned.Time `json:"startTime,omitempty"`
+	// Duration is how long the FaultInjector injects faults for, measured
+	// from StartTime or, if unset, from its creation. Mutually exclusive
+	// with EndTime; if neither is set, it runs until it is deleted.
+	Duration unversioned.Duration `json:"duration,omitempty"`
+	// EndTime is the time the FaultInjector stops injecting faults.
+	EndTime *unversioned.Time `json:"endTime,omitempty"`
+	// TTLSecondsAfterCompletion is the number of seconds after which a
+	// completed FaultInjector is deleted. If unset, it is kept.
+	TTLSecondsAfterCompletion *int32 `json:"ttlSecondsAfterCompletion,omitempty"`
+}
+
+// FaultInjectorSchedule restricts when a FaultInjector injects faults. A
+// round of fault injection only runs while the current time falls within one
+// of the Windows, or matches the Cron expression.
+type FaultInjectorSchedule struct {
+	// TimeZone is the IANA name of the time zone in which the schedule is
+	// evaluated, e.g. "Europe/London". Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Cron is a cron expression of five fields (minute, hour, day of month,
+	// month and day of week), matching each minute in which rounds may run.
+	Cron string `json:"cron,omitempty"`
+	// Windows are recurring weekly periods in which rounds may run.
+	Windows []ScheduleWindow `json:"windows,omitempty"`
+}
+
+// ScheduleWindow is a period of the day, on some days of the week.
+type ScheduleWindow struct {
+	// Days are the days of the week on which the window starts, given as
+	// names such as "Mon" or ranges such as "Mon-Fri". Defaults to every day.
+	Days []string `json:"days,omitempty"`
+	// Start and End are times of day such as "10:00". A window which ends
+	// before it starts runs past midnight.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// FaultInjectorStatus reports the observed state of a FaultInjector. It is
+// written by the controller as it reconciles the FaultInjector, and by the
+// injectors as they inject faults.
+type FaultInjectorStatus struct {
+	// Phase summarizes the Conditions of the FaultInjector.
+	Phase FaultInjectorPhase `json:"phase,omitempty"`
+	// Conditions holds the latest observations of the FaultInjector's state.
+	Conditions []FaultInjectorCondition `json:"conditions,omitempty"`
+	// ObservedGeneration is the generation of the FaultInjector most
+	// recently reconciled by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Deployment is the name of the Deployment running the injectors.
+	Deployment string `json:"deployment,omitempty"`
+	// LastFaultTime is the time the most recent fault was injected.
+	LastFaultTime *unversioned.Time `json:"lastFaultTime,omitempty"`
+	// TotalFaults is the number of faults injected so far.
+	TotalFaults int64 `json:"totalFaults,omitempty"`
+	// DeniedFaults is the number of faults the injectors did not inject
+	// because the cluster-wide budget was exhausted.
+	DeniedFaults int64 `json:"deniedFaults,omitempty"`
+	// CompletionTime is the time the FaultInjector completed, at the end of
+	// its Duration or at its EndTime.
+	CompletionTime *unversioned.Time `json:"completionTime,omitempty"`
+}
+
+// FaultInjectorPhase is a summary of the state of a FaultInjector.
+type FaultInjectorPhase string
+
+const (
+	// FaultInjectorPending means the FaultInjector was accepted, but its
+	// injectors are not running yet.
+	FaultInjectorPending FaultInjectorPhase = "Pending"
+	// FaultInjectorRunning means the injectors of the FaultInjector are running.
+	FaultInjectorRunning FaultInjectorPhase = "Running"
+	// FaultInjectorFailed means the controller could not reconcile the
+	// FaultInjector. The Accepted condition holds the reason.
+	FaultInjectorFailed FaultInjectorPhase = "Failed"
+	// FaultInjectorSuspended means the injectors of the FaultInjector were
+	// stopped by the cluster-wide kill switch or a blackout. The Suspended
+	// condition holds the reason.
+	FaultInjectorSuspended FaultInjectorPhase = "Suspended"
+	// FaultInjectorPaused means the injectors of the FaultInjector were
+	// stopped because spec.paused is set.
+	FaultInjectorPaused FaultInjectorPhase = "Paused"
+	// FaultInjectorCompleted means the FaultInjector reached its end time,
+	// and its injectors were removed.
+	FaultInjectorCompleted FaultInjectorPhase = "Completed"
+	// FaultInjectorTerminating means the FaultInjector is being deleted, and
+	// the controller is stopping its injectors.
+	FaultInjectorTerminating FaultInjectorPhase = "Terminating"
+)
+
+// FaultInjectorCondition describes one aspect of the state of a FaultInjector.
+type FaultInjectorCondition struct {
+	Type               FaultInjectorConditionType `json:"type"`
+	Status             v1.ConditionStatus         `json:"status"`
+	LastTransitionTime unversioned.Time           `json:"lastTransitionTime,omitempty"`
+	Reason             string                     `json:"reason,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+}
+
+// FaultInjectorConditionType is the type of a FaultInjectorCondition.
+type FaultInjectorConditionType string
+
+const (
+	// FaultInjectorAccepted is true when the spec of the FaultInjector is
+	// valid and its Deployment has been created or updated.
+	FaultInjectorAccepted FaultInjectorConditionType = "Accepted"
+	// FaultInjectorReady is true when at least one injector is available.
+	FaultInjectorReady FaultInjectorConditionType = "Ready"
+	// FaultInjectorDegraded is true when some injectors are unavailable.
+	FaultInjectorDegraded FaultInjectorConditionType = "Degraded"
+	// FaultInjectorPausedCondition is true while spec.paused stops the
+	// injectors.
+	FaultInjectorPausedCondition FaultInjectorConditionType = "Paused"
+	// FaultInjectorSuspendedCondition is true while the cluster-wide kill
+	// switch or a blackout stops the injectors.
+	FaultInjectorSuspendedCondition FaultInjectorConditionType = "Suspended"
+	// FaultInjectorCompletedCondition is true once the FaultInjector reached
+	// its end time.
+	FaultInjectorCompletedCondition FaultInjectorConditionType = "Completed"
+)
+
+// FaultInjectorSelector restricts the set of Pods a FaultInjector may act
+// upon. Both selectors use the same syntax as kubectl, e.g.
+// "app=checkout,tier=frontend" or "status.phase=Running".
+type FaultInjectorSelector struct {
+	LabelSelector string `json:"labelSelector,omitempty"`
+	FieldSelector string `json:"fieldSelector,omitempty"`
 }
 
 // FaultInjectorType represents an implemented manner of fault injection.
 type FaultInjectorType string
+
+// FaultRecord describes a single fault injected by a FaultInjector.
+type FaultRecord struct {
+	Time          unversioned.Time `json:"time"`
+	FaultInjector string           `json:"faultInjector"`
+	Pod           string           `json:"pod"`
+	Method        KillMethod       `json:"method"`
+}
+
+// KillMethod represents a manner of killing a Pod.
+type KillMethod string
+
+const (
+	// KillMethodDelete deletes Pods, honoring their termination grace period.
+	KillMethodDelete KillMethod = "delete"
+	// KillMethodEvict evicts Pods, honoring any PodDisruptionBudgets.
+	KillMethodEvict KillMethod = "evict"
+	// KillMethodForceDelete deletes Pods immediately, with no grace period.
+	KillMethodForceDelete KillMethod = "forceDelete"
+)
+
+// IsValid returns whether a KillMethod is supported. The empty KillMethod is
+// valid, and means KillMethodDelete.
+func (m KillMethod) IsValid() bool {
+	switch m {
+	case "", KillMethodDelete, KillMethodEvict, KillMethodForceDelete:
+		return true
+	}
+	return false
+}
+
+// IsOptedIn returns whether an object carries the OptInMarker, as either a
+// label or an annotation.
+func IsOptedIn(meta v1.ObjectMeta) bool {
+	return meta.Labels[OptInMarker] == "true" || meta.Annotations[OptInMarker] == "true"
+}
+
+// IsValidMinAvailable returns whether a MinAvailable is a non-negative number
+// of pods, or a percentage between 0% and 100%.
+func IsValidMinAvailable(minAvailable intstr.IntOrString) bool {
+	if minAvailable.Type == intstr.Int {
+		return minAvailable.IntVal >= 0
+	}
+	if !strings.HasSuffix(minAvailable.StrVal, "%") {
+		return false
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(minAvailable.StrVal, "%"))
+	return err == nil && percent >= 0 && percent <= 100
+}
+
+// ParseMinAvailable parses a MinAvailable given as a number of pods such as
+// "2", or as a percentage such as "50%".
+func ParseMinAvailable(value string) (intstr.IntOrString, error) {
+	minAvailable := intstr.FromString(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		minAvailable = intstr.FromInt(n)
+	}
+	if !IsValidMinAvailable(minAvailable) {
+		return minAvailable, fmt.Errorf("Invalid minimum availability %q: must be a non-negative number or a percentage between 0%% and 100%%", value)
+	}
+	return minAvailable, nil
+}
@@ -0,0 +1,140 @@
+// Package workqueue implements a keyed work queue with per-key exponential
+// backoff, for controllers which must retry failed work without blocking
+// their informers.
+package workqueue
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/1.5/pkg/util/flowcontrol"
+	"k8s.io/client-go/1.5/pkg/util/sets"
+)
+
+// Queue is a work queue of string keys. A key is never held by more than one
+// worker at a time: a key added while it is being processed is only handed
+// out again once the worker processing it calls Done. A key added several
+// times before it is processed is processed once.
+type Queue struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	queue        []string
+	dirty        sets.String
+	processing   sets.String
+	shuttingDown bool
+
+	backoff  *flowcontrol.Backoff
+	requeues map[string]int
+}
+
+// New creates a new Queue. Keys re-added with AddRateLimited wait for
+// baseDelay, doubling with each retry up to maxDelay.
+func New(baseDelay, maxDelay time.Duration) *Queue {
+	q := &Queue{
+		dirty:      sets.NewString(),
+		processing: sets.NewString(),
+		backoff:    flowcontrol.NewBackOff(baseDelay, maxDelay),
+		requeues:   make(map[string]int),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// Add marks a key as needing processing.
+func (q *Queue) Add(key string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.shuttingDown || q.dirty.Has(key) {
+		return
+	}
+	q.dirty.Insert(key)
+	if q.processing.Has(key) {
+		return
+	}
+	q.queue = append(q.queue, key)
+	q.cond.Signal()
+}
+
+// AddAfter adds a key once the given delay has passed.
+func (q *Queue) AddAfter(key string, delay time.Duration) {
+	if delay <= 0 {
+		q.Add(key)
+		return
+	}
+	time.AfterFunc(delay, func() { q.Add(key) })
+}
+
+// AddRateLimited adds a key after its backoff delay, which grows every time
+// the key is rate limited until Forget is called.
+func (q *Queue) AddRateLimited(key string) {
+	q.lock.Lock()
+	q.requeues[key]++
+	q.backoff.Next(key, time.Now())
+	delay := q.backoff.Get(key)
+	q.lock.Unlock()
+	q.AddAfter(key, delay)
+}
+
+// Forget resets the backoff of a key, e.g. once it was processed successfully.
+func (q *Queue) Forget(key string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.requeues, key)
+	q.backoff.Reset(key)
+}
+
+// NumRequeues returns how many times a key was rate limited since it was last
+// forgotten.
+func (q *Queue) NumRequeues(key string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.requeues[key]
+}
+
+// Get blocks until a key is ready for processing, and returns it. The caller
+// must call Done with the key once it is processed. If the queue is shutting
+// down, Get returns true as its second value.
+func (q *Queue) Get() (string, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.queue) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return "", true
+	}
+	key := q.queue[0]
+	q.queue = q.queue[1:]
+	q.processing.Insert(key)
+	q.dirty.Delete(key)
+	return key, false
+}
+
+// Done marks a key as processed. If it was added again while being
+// processed, it is queued again.
+func (q *Queue) Done(key string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.processing.Delete(key)
+	if q.dirty.Has(key) {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+// Len returns the number of keys ready for processing.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.queue)
+}
+
+// ShutDown makes the queue ignore new keys, and makes Get return once the
+// keys already queued have been handed out.
+func (q *Queue) ShutDown() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
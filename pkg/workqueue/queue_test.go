@@ -0,0 +1,84 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddDeduplicates(t *testing.T) {
+	q := New(time.Millisecond, time.Second)
+	q.Add("lanthanides/cerium")
+	q.Add("lanthanides/cerium")
+	q.Add("actinides/thorium")
+	if q.Len() != 2 {
+		t.Fatalf("Expected 2 queued keys, but found %v", q.Len())
+	}
+
+	key, shutdown := q.Get()
+	if shutdown || key != "lanthanides/cerium" {
+		t.Fatalf("Expected to get lanthanides/cerium, but got %q (shutdown %v)", key, shutdown)
+	}
+
+	// A key added while it is processed waits until it is done.
+	q.Add("lanthanides/cerium")
+	if q.Len() != 1 {
+		t.Errorf("Expected a key being processed not to be queued again, but found %v queued keys", q.Len())
+	}
+	q.Done("lanthanides/cerium")
+	if q.Len() != 2 {
+		t.Errorf("Expected a key added while being processed to be queued once done, but found %v queued keys", q.Len())
+	}
+}
+
+func TestAddRateLimited(t *testing.T) {
+	q := New(10*time.Millisecond, 40*time.Millisecond)
+	for i, expected := range []time.Duration{10, 20, 40, 40} {
+		q.AddRateLimited("lanthanides/cerium")
+		if delay := q.backoff.Get("lanthanides/cerium"); delay != expected*time.Millisecond {
+			t.Errorf("Expected retry %v to wait %v, but found %v", i+1, expected*time.Millisecond, delay)
+		}
+	}
+	if q.NumRequeues("lanthanides/cerium") != 4 {
+		t.Errorf("Expected 4 requeues, but found %v", q.NumRequeues("lanthanides/cerium"))
+	}
+
+	key, _ := q.Get()
+	if key != "lanthanides/cerium" {
+		t.Errorf("Expected to get lanthanides/cerium once its delay passed, but got %q", key)
+	}
+	q.Done(key)
+
+	q.Forget("lanthanides/cerium")
+	if q.NumRequeues("lanthanides/cerium") != 0 {
+		t.Errorf("Expected no requeues after forgetting a key, but found %v", q.NumRequeues("lanthanides/cerium"))
+	}
+	q.AddRateLimited("lanthanides/cerium")
+	if delay := q.backoff.Get("lanthanides/cerium"); delay != 10*time.Millisecond {
+		t.Errorf("Expected the delay to be reset after forgetting a key, but found %v", delay)
+	}
+}
+
+func TestShutDown(t *testing.T) {
+	q := New(time.Millisecond, time.Second)
+	q.Add("lanthanides/cerium")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if key, shutdown := q.Get(); shutdown || key != "lanthanides/cerium" {
+			t.Errorf("Expected to get the queued key before shutting down, but got %q (shutdown %v)", key, shutdown)
+		}
+		if _, shutdown := q.Get(); !shutdown {
+			t.Errorf("Expected Get to report the queue shutting down")
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.ShutDown()
+	q.Add("actinides/thorium")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Get to return after shutting down")
+	}
+}
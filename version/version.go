@@ -7,6 +7,6 @@ var (
 	// ImageRepo is the container image repository and should be specified at
 	// compile time with, e.g., "-X version.ImageRepo=gcr.io/puppet-panda-dev".
 	ImageRepo string
-	// ResourceAPIVersion is the API version for ThirdPartyResources.
+	// ResourceAPIVersion is the API version of the FaultInjector resource.
 	ResourceAPIVersion = "v1alpha1"
 )